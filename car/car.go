@@ -0,0 +1,308 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package car reads and writes archives in the CARv1 format
+// (https://ipld.io/specs/transport/car/carv1/), which is used to move whole object graphs between
+// stores.
+package car
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-varint"
+)
+
+const version = 1
+
+// MaxSectionSize is the largest section (block CID plus data) that is accepted when reading an
+// archive.
+const MaxSectionSize = 1 << 30
+
+// Writer writes a CAR archive to an underlying writer.
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter writes the header of a CAR archive with the given roots to w, and returns a Writer to
+// which blocks may then be appended.
+func NewWriter(w io.Writer, roots []cid.Cid) (*Writer, error) {
+	header, err := encodeHeader(roots)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode header: %w", err)
+	}
+	if err := writeSection(w, header); err != nil {
+		return nil, fmt.Errorf("could not write header: %w", err)
+	}
+	return &Writer{w: w}, nil
+}
+
+// WriteBlock appends a block to the archive. It is up to the caller to ensure that data matches c.
+func (w *Writer) WriteBlock(c cid.Cid, data []byte) error {
+	return writeSection(w.w, append(c.Bytes(), data...))
+}
+
+func writeSection(w io.Writer, b []byte) error {
+	if _, err := w.Write(varint.ToUvarint(uint64(len(b)))); err != nil {
+		return err
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// Reader reads the blocks of a CAR archive.
+type Reader struct {
+	Roots []cid.Cid
+
+	r *bufio.Reader
+}
+
+// NewReader reads the header of the CAR archive from r.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	header, err := readSection(br)
+	if err == io.EOF {
+		return nil, fmt.Errorf("empty archive")
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read header: %w", err)
+	}
+	roots, err := decodeHeader(header)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode header: %w", err)
+	}
+	return &Reader{
+		Roots: roots,
+		r:     br,
+	}, nil
+}
+
+// Next returns the next block in the archive, or io.EOF if there are no more blocks. Callers are
+// expected to verify that the data matches the returned CID.
+func (r *Reader) Next() (cid.Cid, []byte, error) {
+	b, err := readSection(r.r)
+	if err != nil {
+		return cid.Cid{}, nil, err
+	}
+	n, c, err := cid.CidFromBytes(b)
+	if err != nil {
+		return cid.Cid{}, nil, fmt.Errorf("could not decode block CID: %w", err)
+	}
+	return c, b[n:], nil
+}
+
+func readSection(r *bufio.Reader) ([]byte, error) {
+	length, err := varint.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if length > MaxSectionSize {
+		return nil, fmt.Errorf("section too large: %d bytes", length)
+	}
+	// The length comes from the archive, so memory is only allocated as the data is actually read.
+	b := &bytes.Buffer{}
+	if _, err := io.CopyN(b, r, int64(length)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("could not read section: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// The header is a DAG-CBOR map of the form {"roots": [CID...], "version": 1}. Only the subset of
+// CBOR needed to represent it is implemented here.
+
+const (
+	majorUint   = 0
+	majorBytes  = 2
+	majorText   = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorTag    = 6
+	tagCID      = 42
+	headerRoots = "roots"
+	headerVer   = "version"
+)
+
+func encodeHeader(roots []cid.Cid) ([]byte, error) {
+	b := &bytes.Buffer{}
+	// Keys are sorted by length first, then bytewise, as required by DAG-CBOR.
+	writeCBORHead(b, majorMap, 2)
+	writeCBORHead(b, majorText, uint64(len(headerRoots)))
+	b.WriteString(headerRoots)
+	writeCBORHead(b, majorArray, uint64(len(roots)))
+	for _, root := range roots {
+		// CIDs are encoded as byte strings with a leading zero byte (the identity multibase prefix).
+		writeCBORHead(b, majorTag, tagCID)
+		rb := append([]byte{0}, root.Bytes()...)
+		writeCBORHead(b, majorBytes, uint64(len(rb)))
+		b.Write(rb)
+	}
+	writeCBORHead(b, majorText, uint64(len(headerVer)))
+	b.WriteString(headerVer)
+	writeCBORHead(b, majorUint, version)
+	return b.Bytes(), nil
+}
+
+func decodeHeader(header []byte) ([]cid.Cid, error) {
+	r := bytes.NewReader(header)
+	major, n, err := readCBORHead(r)
+	if err != nil {
+		return nil, err
+	}
+	if major != majorMap {
+		return nil, fmt.Errorf("expected map, got major type %d", major)
+	}
+	var roots []cid.Cid
+	ver := uint64(0)
+	for i := uint64(0); i < n; i++ {
+		key, err := readCBORText(r)
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case headerRoots:
+			major, count, err := readCBORHead(r)
+			if err != nil {
+				return nil, err
+			}
+			if major != majorArray {
+				return nil, fmt.Errorf("expected array of roots, got major type %d", major)
+			}
+			for j := uint64(0); j < count; j++ {
+				root, err := readCBORCID(r)
+				if err != nil {
+					return nil, fmt.Errorf("could not read root #%d: %w", j, err)
+				}
+				roots = append(roots, root)
+			}
+		case headerVer:
+			major, v, err := readCBORHead(r)
+			if err != nil {
+				return nil, err
+			}
+			if major != majorUint {
+				return nil, fmt.Errorf("expected integer version, got major type %d", major)
+			}
+			ver = v
+		default:
+			return nil, fmt.Errorf("unexpected header key %q", key)
+		}
+	}
+	if ver != version {
+		return nil, fmt.Errorf("unsupported version %d", ver)
+	}
+	return roots, nil
+}
+
+func writeCBORHead(b *bytes.Buffer, major byte, n uint64) {
+	m := major << 5
+	switch {
+	case n < 24:
+		b.WriteByte(m | byte(n))
+	case n <= 0xff:
+		b.WriteByte(m | 24)
+		b.WriteByte(byte(n))
+	case n <= 0xffff:
+		b.WriteByte(m | 25)
+		b.Write([]byte{byte(n >> 8), byte(n)})
+	case n <= 0xffffffff:
+		b.WriteByte(m | 26)
+		b.Write([]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)})
+	default:
+		b.WriteByte(m | 27)
+		for i := 7; i >= 0; i-- {
+			b.WriteByte(byte(n >> (8 * i)))
+		}
+	}
+}
+
+func readCBORHead(r *bytes.Reader) (byte, uint64, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not read CBOR head: %w", err)
+	}
+	major := first >> 5
+	info := first & 0x1f
+	if info < 24 {
+		return major, uint64(info), nil
+	}
+	size := 0
+	switch info {
+	case 24:
+		size = 1
+	case 25:
+		size = 2
+	case 26:
+		size = 4
+	case 27:
+		size = 8
+	default:
+		return 0, 0, fmt.Errorf("unsupported CBOR additional info %d", info)
+	}
+	n := uint64(0)
+	for i := 0; i < size; i++ {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, 0, fmt.Errorf("could not read CBOR head: %w", err)
+		}
+		n = n<<8 | uint64(c)
+	}
+	return major, n, nil
+}
+
+func readCBORBytes(r *bytes.Reader, wantMajor byte) ([]byte, error) {
+	major, n, err := readCBORHead(r)
+	if err != nil {
+		return nil, err
+	}
+	if major != wantMajor {
+		return nil, fmt.Errorf("expected major type %d, got %d", wantMajor, major)
+	}
+	if n > uint64(r.Len()) {
+		return nil, fmt.Errorf("CBOR string too long: %d", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func readCBORText(r *bytes.Reader) (string, error) {
+	b, err := readCBORBytes(r, majorText)
+	return string(b), err
+}
+
+func readCBORCID(r *bytes.Reader) (cid.Cid, error) {
+	major, tag, err := readCBORHead(r)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	if major != majorTag || tag != tagCID {
+		return cid.Cid{}, fmt.Errorf("expected CID tag")
+	}
+	b, err := readCBORBytes(r, majorBytes)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	if len(b) == 0 || b[0] != 0 {
+		return cid.Cid{}, fmt.Errorf("invalid CID multibase prefix")
+	}
+	return cid.Cast(b[1:])
+}
@@ -0,0 +1,79 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package car
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/google/ent/utils"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/multiformats/go-varint"
+)
+
+func TestRoundTrip(t *testing.T) {
+	blocks := [][]byte{
+		[]byte("hello"),
+		[]byte("world"),
+	}
+	links := []cid.Cid{}
+	for _, b := range blocks {
+		links = append(links, cid.NewCidV1(utils.TypeRaw, multihash.Multihash(utils.ComputeDigest(b))))
+	}
+
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, links[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, b := range blocks {
+		if err := w.WriteBlock(links[i], b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Roots) != 1 || !r.Roots[0].Equals(links[0]) {
+		t.Fatalf("unexpected roots: %v", r.Roots)
+	}
+	for i, b := range blocks {
+		c, data, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !c.Equals(links[i]) || !bytes.Equal(data, b) {
+			t.Fatalf("unexpected block #%d: %v %q", i, c, data)
+		}
+	}
+	if _, _, err := r.Next(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestMalformedSectionLength(t *testing.T) {
+	for _, length := range []uint64{MaxSectionSize + 1, 1 << 62, 1 << 20} {
+		// The declared length is not backed by actual data.
+		r := bytes.NewReader(append(varint.ToUvarint(length), 0xa2))
+		if _, err := NewReader(r); err == nil {
+			t.Fatalf("expected error for section length %d", length)
+		}
+	}
+}
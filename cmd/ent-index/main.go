@@ -0,0 +1,248 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/subtle"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/google/ent/api"
+	"github.com/google/ent/index"
+	"github.com/google/ent/log"
+	"github.com/google/ent/nodeservice"
+	"github.com/google/ent/utils"
+)
+
+// ent-index serves the JSON API used by `ent get` and `ent snapshot` from a local index directory,
+// as laid out by the indexer. The raw index files are also served as static files, so that the same
+// server may be used as an index remote.
+
+var (
+	indexDir      = flag.String("index", "", "path to index directory")
+	listenAddress = flag.String("listen", ":8081", "address to listen on")
+	prefix        = flag.String("prefix", "/v1", "path prefix of the API methods")
+	remoteURL     = flag.String("remote", "", "optional ent-server in which to store snapshots")
+	remoteAPIKey  = flag.String("api-key", "", "API key for the ent-server")
+	secretKeyFlag = flag.String("secret-key", "", "optional secret key (as printed by ent keygen) with which to sign index entries")
+	snapshotKeys  = flag.String("snapshot-api-keys", "", "comma-separated API keys allowed to call Snapshot; Snapshot is disabled if empty")
+	snapshotHosts = flag.String("snapshot-allowed-hosts", "", "optional comma-separated hosts (and their subdomains) that Snapshot may fetch from")
+
+	objectStore nodeservice.ObjectStore
+	secretKey   *ecdsa.PrivateKey
+)
+
+func main() {
+	flag.Parse()
+
+	ctx := context.Background()
+	if *indexDir == "" {
+		log.Errorf(ctx, "must specify index")
+		os.Exit(1)
+	}
+
+	if *remoteURL != "" {
+		r, err := nodeservice.DialRemote(*remoteURL, *remoteAPIKey)
+		if err != nil {
+			log.Errorf(ctx, "could not dial remote: %v", err)
+			os.Exit(1)
+		}
+		objectStore = r
+	}
+
+	if *secretKeyFlag != "" {
+		k, err := utils.ParseSecretKey(*secretKeyFlag)
+		if err != nil {
+			log.Errorf(ctx, "invalid secret key: %v", err)
+			os.Exit(1)
+		}
+		secretKey = k
+	}
+
+	router := gin.Default()
+
+	corsConfig := cors.DefaultConfig()
+	corsConfig.AllowAllOrigins = true
+	corsConfig.AddAllowHeaders(nodeservice.APIKeyHeader)
+	router.Use(cors.New(corsConfig))
+
+	router.POST(*prefix+"/"+api.GET_ENTRY_METHOD_ID, getEntryHandler)
+	router.POST(*prefix+"/"+api.SNAPSHOT_METHOD_ID, snapshotHandler)
+	// Serve the index files both at the root and under the API prefix, since clients may use the
+	// same base URL for both.
+	files := http.FileServer(http.Dir(*indexDir))
+	router.NoRoute(func(c *gin.Context) {
+		c.Request.URL.Path = strings.TrimPrefix(c.Request.URL.Path, *prefix)
+		files.ServeHTTP(c.Writer, c.Request)
+	})
+
+	log.Infof(ctx, "serving index %q on %q", *indexDir, *listenAddress)
+	log.Criticalf(ctx, "%v", router.Run(*listenAddress))
+}
+
+func getEntryHandler(c *gin.Context) {
+	ctx := c
+	var req api.GetEntryRequest
+	err := c.BindJSON(&req)
+	if err != nil {
+		log.Warningf(ctx, "could not parse request: %v", err)
+		return
+	}
+	digest, err := utils.DigestFromApi(req.Digests)
+	if err != nil {
+		log.Warningf(ctx, "invalid digest: %v", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	entry, err := index.ReadEntry(*indexDir, digest)
+	if os.IsNotExist(err) {
+		log.Infof(ctx, "entry not found: %s", utils.DigestForLog(digest))
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Errorf(ctx, "could not read entry %s: %v", utils.DigestForLog(digest), err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	res := api.GetEntryResponse{
+		Metadata: api.ObjectMetadata{
+			Digests:     utils.DigestToApi(digest),
+			LengthBytes: int64(entry.Size),
+			ContentType: entry.MediaType,
+		},
+	}
+	for _, u := range entry.URLS {
+		res.Mirrors = append(res.Mirrors, api.Mirror{
+			URL: u,
+		})
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// snapshotHandler fetches the requested URL, records it in the index and, if configured, stores the
+// content in the object store, so that it remains available even if the URL changes.
+//
+// Since it makes the server fetch arbitrary URLs, it requires one of the configured API keys, and
+// only fetches from public addresses of the allowed hosts.
+func snapshotHandler(c *gin.Context) {
+	ctx := c
+	if !snapshotAllowed(c.Request.Header.Get(nodeservice.APIKeyHeader)) {
+		log.Warningf(ctx, "snapshot request with invalid API key")
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	var req api.SnapshotRequest
+	err := c.BindJSON(&req)
+	if err != nil {
+		log.Warningf(ctx, "could not parse request: %v", err)
+		return
+	}
+	if err := checkSnapshotURL(req.URL); err != nil {
+		log.Warningf(ctx, "rejected snapshot of %q: %v", req.URL, err)
+		c.String(http.StatusForbidden, "%v", err)
+		return
+	}
+	u, data, mediaType, err := index.FetchWithClient(ctx, index.PublicClient, req.URL)
+	if err != nil {
+		log.Warningf(ctx, "could not fetch %q: %v", req.URL, err)
+		c.String(http.StatusBadGateway, "could not fetch URL: %v", err)
+		return
+	}
+	if objectStore != nil {
+		digest, err := objectStore.Put(ctx, data)
+		if err != nil {
+			log.Errorf(ctx, "could not store %s: %v", utils.DigestForLog(digest), err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+	}
+	entry, err := index.Add(*indexDir, data, mediaType, u)
+	if err != nil {
+		log.Errorf(ctx, "could not add %q to index: %v", u, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if secretKey != nil {
+		err := index.SignEntry(*indexDir, utils.ComputeDigest(data), secretKey)
+		if err != nil {
+			log.Errorf(ctx, "could not sign entry for %q: %v", u, err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+	}
+	log.Infof(ctx, "snapshot of %q: %+v", u, entry)
+	c.JSON(http.StatusOK, api.SnapshotResponse{
+		Metadata: api.ObjectMetadata{
+			Digests:     utils.ComputeApiDigests(data),
+			LengthBytes: int64(entry.Size),
+			ContentType: entry.MediaType,
+		},
+	})
+}
+
+func snapshotAllowed(apiKey string) bool {
+	if apiKey == "" {
+		return false
+	}
+	for _, k := range splitList(*snapshotKeys) {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(apiKey)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSnapshotURL checks that u is an HTTP(S) URL on one of the allowed hosts, if any are
+// configured.
+func checkSnapshotURL(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q", parsed.Scheme)
+	}
+	hosts := splitList(*snapshotHosts)
+	if len(hosts) == 0 {
+		return nil
+	}
+	host := strings.ToLower(parsed.Hostname())
+	for _, h := range hosts {
+		h = strings.ToLower(h)
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return nil
+		}
+	}
+	return fmt.Errorf("host %q not allowed", host)
+}
+
+func splitList(s string) []string {
+	out := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -15,6 +15,8 @@
 
 package main
 
+import "time"
+
 type Config struct {
 	ProjectID string
 
@@ -31,16 +33,44 @@ type Config struct {
 	CloudStorageEnabled bool
 	CloudStorageBucket  string
 
+	// Whether to store compressible objects compressed with zstd.
+	CompressionEnabled bool
+
 	GinMode  string
 	LogLevel string
 
 	Remotes []Remote
+	// Indexers whose signatures over index entries are trusted, for index remotes.
+	TrustedIndexers []TrustedIndexer
 
 	Users []User
 }
 
-type Remote struct {
+type TrustedIndexer struct {
 	Name string
+	// As printed by `ent keygen`.
+	PublicKey string
+}
+
+type Remote struct {
+	Name   string
+	URL    string
+	APIKey string
+	// Whether URL points to an index rather than an ent-server.
+	Index bool
+	// Whether the index is served in the packed layout (see indexer pack).
+	Packed bool
+	// For index remotes, whether to reject entries not signed by one of the trusted indexers.
+	RequireSignature bool
+	// Compressor for gRPC messages, either "gzip" or "zstd"; none by default.
+	Compression string
+
+	// Whether to fetch objects missing from the local store from this remote.
+	Proxy bool
+
+	// CIDs of trees to periodically copy from this remote into the local store.
+	SyncRoots    []string
+	SyncInterval time.Duration
 }
 
 type User struct {
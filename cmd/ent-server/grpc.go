@@ -19,14 +19,19 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"math"
 	"time"
 
 	"cloud.google.com/go/storage"
+	"github.com/google/ent/compression"
 	"github.com/google/ent/log"
+	"github.com/google/ent/nodeservice"
 	pb "github.com/google/ent/proto"
 	"github.com/google/ent/utils"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func redact(s string) string {
@@ -72,7 +77,7 @@ func (grpcServer) GetEntry(req *pb.GetEntryRequest, s pb.Ent_GetEntryServer) err
 
 	log.Debugf(ctx, "getting blob: %q", digest.String())
 	blob, err := blobStore.Get(ctx, digest)
-	if err == storage.ErrObjectNotExist {
+	if err == storage.ErrObjectNotExist || err == nodeservice.ErrNotFound {
 		log.Warningf(ctx, "blob not found: %q", digest.String())
 		return status.Errorf(codes.NotFound, "blob not found: %q", digest.String())
 	} else if err != nil {
@@ -81,6 +86,15 @@ func (grpcServer) GetEntry(req *pb.GetEntryRequest, s pb.Ent_GetEntryServer) err
 	}
 	log.Debugf(ctx, "got blob: %q", digest.String())
 
+	// Compress the response only if the object is worth it, with a compressor the client supports.
+	advertised, err := grpc.ClientSupportedCompressors(ctx)
+	if err == nil {
+		err = grpc.SetSendCompressor(ctx, compression.SendCompressor(blob, advertised))
+	}
+	if err != nil {
+		log.Warningf(ctx, "could not set compressor: %s", err)
+	}
+
 	err = s.Send(&pb.GetEntryResponse{
 		Entry: &pb.GetEntryResponse_Metadata{
 			Metadata: &pb.EntryMetadata{
@@ -136,25 +150,28 @@ func (grpcServer) GetEntryMetadata(ctx context.Context, req *pb.GetEntryMetadata
 	digest := utils.DigestFromProto(req.Digest)
 	log.Debugf(ctx, "digest: %q", digest.String())
 
-	log.Debugf(ctx, "getting blob: %q", digest.String())
-	ok, err := blobStore.Has(ctx, digest)
-	if err != nil {
-		log.Warningf(ctx, "could not get blob: %s", err)
-		return nil, status.Errorf(codes.Internal, "could not get blob: %s", err)
-	}
-	log.Debugf(ctx, "got blob: %q = %v", digest.String(), ok)
-
-	if !ok {
+	log.Debugf(ctx, "getting blob metadata: %q", digest.String())
+	m, err := blobStore.GetMetadata(ctx, digest)
+	if err == nodeservice.ErrNotFound {
 		return nil, status.Errorf(codes.NotFound, "blob not found: %q", digest.String())
+	} else if err != nil {
+		log.Warningf(ctx, "could not get blob metadata: %s", err)
+		return nil, status.Errorf(codes.Internal, "could not get blob metadata: %s", err)
 	}
+	log.Debugf(ctx, "got blob metadata: %q = %+v", digest.String(), m)
 
 	res := &pb.GetEntryMetadataResponse{
 		Metadata: &pb.EntryMetadata{
 			Digests: []*pb.Digest{
 				utils.DigestToProto(digest),
 			},
+			Size:      m.Size,
+			MediaType: m.MediaType,
 		},
 	}
+	if !m.CreationTime.IsZero() {
+		res.Metadata.CreationTime = timestamppb.New(m.CreationTime)
+	}
 
 	return res, nil
 }
@@ -263,7 +280,10 @@ func (grpcServer) GetTag(ctx context.Context, req *pb.GetTagRequest) (*pb.GetTag
 					Code:   uint64(entry.Target.Code),
 					Digest: entry.Target.Digest,
 				},
+				Sequence: uint64(entry.Sequence),
 			},
+			TagSignature: entry.EntrySignature,
+			PublicKey:    entry.PublicKey,
 		},
 	}, nil
 
@@ -273,6 +293,14 @@ func (grpcServer) GetTag(ctx context.Context, req *pb.GetTagRequest) (*pb.GetTag
 func (grpcServer) SetTag(ctx context.Context, req *pb.SetTagRequest) (*pb.SetTagResponse, error) {
 	log.Debugf(ctx, "req: %s", req)
 
+	_, err := utils.VerifyTag(req.GetSignedTag())
+	if err != nil {
+		log.Warningf(ctx, "invalid tag: %s", err)
+		return nil, status.Errorf(codes.InvalidArgument, "invalid tag: %s", err)
+	}
+	if req.SignedTag.Tag.Sequence > math.MaxInt64 {
+		return nil, status.Errorf(codes.InvalidArgument, "tag sequence out of range")
+	}
 	e := MapEntry{
 		PublicKey: req.SignedTag.PublicKey,
 		Label:     req.SignedTag.Tag.Label,
@@ -282,10 +310,13 @@ func (grpcServer) SetTag(ctx context.Context, req *pb.SetTagRequest) (*pb.SetTag
 		},
 		EntrySignature: req.SignedTag.TagSignature,
 		CreationTime:   time.Now(),
+		Sequence:       int64(req.SignedTag.Tag.Sequence),
 	}
-	// TODO: Check signature.
-	err := store.SetMapEntry(ctx, &e)
-	if err != nil {
+	err = store.SetMapEntry(ctx, &e)
+	if err == ErrStaleTag {
+		log.Warningf(ctx, "stale tag: %d", e.Sequence)
+		return nil, status.Errorf(codes.FailedPrecondition, "tag sequence %d is not higher than the current one", e.Sequence)
+	} else if err != nil {
 		log.Errorf(ctx, "could not set tag: %s", err)
 		return nil, status.Errorf(codes.Internal, "could not set tag: %s", err)
 	}
@@ -17,6 +17,7 @@ package main
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"flag"
 	"fmt"
 	"net/http"
@@ -30,6 +31,7 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
+	"github.com/google/ent/compression"
 	"github.com/google/ent/datastore"
 	"github.com/google/ent/log"
 	"github.com/google/ent/nodeservice"
@@ -87,6 +89,12 @@ func readConfig() Config {
 	if err != nil {
 		panic(err)
 	}
+	for _, remote := range config.Remotes {
+		err := compression.CheckGRPCCompressor(remote.Compression)
+		if err != nil {
+			panic(fmt.Errorf("invalid compression for remote %q: %w", remote.Name, err))
+		}
+	}
 	return config
 }
 
@@ -153,6 +161,13 @@ func main() {
 		}
 	}
 
+	if config.CompressionEnabled {
+		log.Infof(ctx, "using compression")
+		ds = datastore.Compressed{
+			Inner: ds,
+		}
+	}
+
 	if config.RedisEnabled {
 		log.Infof(ctx, "using Redis: %q", config.RedisEndpoint)
 		rdb := redis.NewClient(&redis.Options{
@@ -179,6 +194,17 @@ func main() {
 		Inner: ds,
 	}
 
+	upstream := getUpstream(ctx, config.Remotes, trustedKeys(ctx, config.TrustedIndexers))
+	if len(upstream.Inner) > 0 {
+		log.Infof(ctx, "proxying missing objects to %d remotes", len(upstream.Inner))
+		blobStore = nodeservice.Proxy{
+			Local:    blobStore,
+			Upstream: upstream,
+		}
+	}
+
+	startReplicators(ctx, config.Remotes)
+
 	fs := initStore(ctx, config.ProjectID)
 	store = Store{
 		c: fs,
@@ -214,6 +240,51 @@ func main() {
 	log.Criticalf(ctx, "%v", err)
 }
 
+// getUpstream returns a Sequence of the remotes configured as proxy upstreams, in config order.
+func getUpstream(ctx context.Context, remotes []Remote, trustedKeys []*ecdsa.PublicKey) nodeservice.Sequence {
+	inner := []nodeservice.Inner{}
+	for _, remote := range remotes {
+		if !remote.Proxy {
+			continue
+		}
+		if remote.Index {
+			inner = append(inner, nodeservice.Inner{
+				Name: remote.Name,
+				ObjectGetter: nodeservice.IndexClient{
+					BaseURL:          remote.URL,
+					TrustedKeys:      trustedKeys,
+					RequireSignature: remote.RequireSignature,
+					Packed:           remote.Packed,
+					Manifests:        nodeservice.NewManifestCache(0),
+				},
+			})
+		} else {
+			r, err := nodeservice.NewRemote(remote.Name, remote.URL, remote.APIKey, nodeservice.WithCompressor(remote.Compression)...)
+			if err != nil {
+				log.Errorf(ctx, "skipping upstream: %v", err)
+				continue
+			}
+			inner = append(inner, r)
+		}
+	}
+	return nodeservice.Sequence{
+		Inner: inner,
+	}
+}
+
+func trustedKeys(ctx context.Context, indexers []TrustedIndexer) []*ecdsa.PublicKey {
+	keys := []*ecdsa.PublicKey{}
+	for _, t := range indexers {
+		pk, err := utils.ParsePublicKey(t.PublicKey)
+		if err != nil {
+			log.Errorf(ctx, "invalid public key for trusted indexer %q: %v", t.Name, err)
+			continue
+		}
+		keys = append(keys, pk)
+	}
+	return keys
+}
+
 func indexHandler(c *gin.Context) {
 	c.HTML(http.StatusOK, "index.tmpl", gin.H{})
 }
@@ -21,7 +21,9 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/ent/compression"
 	"github.com/google/ent/log"
+	"github.com/google/ent/mediatype"
 	"github.com/google/ent/utils"
 )
 
@@ -76,7 +78,22 @@ func rawGetHandler(c *gin.Context) {
 	}
 	accessItem.Found = append(accessItem.Found, string(digest))
 
-	c.Data(http.StatusOK, "text/plain; charset=utf-8", nodeRaw)
+	// Stored media types are themselves detected from the contents when objects are written, so
+	// there is no need to look them up.
+	contentType := mediatype.Detect("", "", nodeRaw)
+	log.Debugf(ctx, "content type: %s", contentType)
+
+	// Objects are arbitrary user content served from the API origin, so browsers must neither guess
+	// a different type nor run any scripts or forms in them, even if they are HTML.
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "sandbox")
+	body, coding := compression.EncodeResponse(c.GetHeader("Accept-Encoding"), nodeRaw)
+	c.Header("Vary", "Accept-Encoding")
+	if coding != "" {
+		log.Debugf(ctx, "content encoding: %s", coding)
+		c.Header("Content-Encoding", coding)
+	}
+	c.Data(http.StatusOK, contentType, body)
 }
 
 func rawPutHandler(c *gin.Context) {
@@ -0,0 +1,73 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/ent/dag"
+	"github.com/google/ent/log"
+	"github.com/google/ent/nodeservice"
+	"github.com/ipfs/go-cid"
+)
+
+const defaultSyncInterval = time.Hour
+
+// startReplicators starts a background loop for each remote with sync roots, which periodically
+// copies the missing objects of those trees into the local store.
+func startReplicators(ctx context.Context, remotes []Remote) {
+	for _, remote := range remotes {
+		if len(remote.SyncRoots) == 0 {
+			continue
+		}
+		roots := make([]cid.Cid, 0, len(remote.SyncRoots))
+		for _, r := range remote.SyncRoots {
+			root, err := cid.Decode(r)
+			if err != nil {
+				log.Errorf(ctx, "invalid sync root %q for remote %q: %v", r, remote.Name, err)
+				continue
+			}
+			roots = append(roots, root)
+		}
+		src, err := nodeservice.DialRemote(remote.URL, remote.APIKey, nodeservice.WithCompressor(remote.Compression)...)
+		if err != nil {
+			log.Errorf(ctx, "could not dial remote %q: %v", remote.Name, err)
+			continue
+		}
+		interval := remote.SyncInterval
+		if interval <= 0 {
+			interval = defaultSyncInterval
+		}
+		log.Infof(ctx, "replicating %d roots from remote %q every %v", len(roots), remote.Name, interval)
+		go replicate(ctx, remote.Name, src, roots, interval)
+	}
+}
+
+func replicate(ctx context.Context, name string, src nodeservice.ObjectGetter, roots []cid.Cid, interval time.Duration) {
+	for {
+		for _, root := range roots {
+			start := time.Now()
+			stats, err := dag.Sync(ctx, src, blobStore, root)
+			if err != nil {
+				log.Errorf(ctx, "could not replicate %s from remote %q: %v", root, name, err)
+				continue
+			}
+			log.Infof(ctx, "replicated %s from remote %q in %v: copied %d objects (%d bytes), skipped %d", root, name, time.Since(start), stats.Copied, stats.Bytes, stats.Skipped)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
 )
 
 type Store struct {
@@ -35,10 +37,23 @@ type MapEntry struct {
 	CreationTime    time.Time `firestore:"4"`
 	ClientIPAddress string    `firestore:"5"`
 	RequestBytes    []byte    `firestore:"6"`
+
+	// Sequence number of the tag; Firestore does not support unsigned integers.
+	Sequence int64 `firestore:"7"`
+}
+
+// ErrStaleTag is returned by SetMapEntry if there is already an entry for the same public key and
+// label with the same or a higher sequence number.
+var ErrStaleTag = errors.New("stale tag")
+
+// latestMapEntry returns the query for the entry with the highest sequence number for the public
+// key and label.
+func (s *Store) latestMapEntry(publicKey []byte, label string) firestore.Query {
+	return s.c.Collection(MapEntryCollection).Query.Where("0", "==", publicKey).Where("1", "==", label).OrderBy("7", firestore.Desc).Limit(1)
 }
 
 func (s *Store) GetMapEntry(ctx context.Context, publicKey []byte, label string) (*MapEntry, error) {
-	docs := s.c.Collection(MapEntryCollection).Query.Where("0", "==", publicKey).Where("1", "==", label).Documents(ctx)
+	docs := s.latestMapEntry(publicKey, label).Documents(ctx)
 	doc, err := docs.Next()
 	if err != nil { // Not found.
 		return nil, nil
@@ -50,7 +65,23 @@ func (s *Store) GetMapEntry(ctx context.Context, publicKey []byte, label string)
 	return &e, nil
 }
 
+// SetMapEntry adds the entry, unless it is older than the latest one for the same public key and
+// label, in which case ErrStaleTag is returned.
 func (s *Store) SetMapEntry(ctx context.Context, e *MapEntry) error {
-	_, _, err := s.c.Collection(MapEntryCollection).Add(ctx, e)
-	return err
+	return s.c.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docs := tx.Documents(s.latestMapEntry(e.PublicKey, e.Label))
+		doc, err := docs.Next()
+		if err == nil {
+			latest := MapEntry{}
+			if err := doc.DataTo(&latest); err != nil {
+				return err
+			}
+			if latest.Sequence >= e.Sequence {
+				return ErrStaleTag
+			}
+		} else if err != iterator.Done {
+			return err
+		}
+		return tx.Create(s.c.Collection(MapEntryCollection).NewDoc(), e)
+	})
 }
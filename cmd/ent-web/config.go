@@ -15,6 +15,8 @@
 
 package main
 
+import "time"
+
 type Config struct {
 	ProjectID string
 
@@ -22,11 +24,41 @@ type Config struct {
 
 	DomainName string
 
+	// One of "host" (default), which serves each DAG from its own origin <cid>.www.<DomainName> so
+	// that sites are isolated from each other, or "path", which serves them all under /ent/<cid>/
+	// on a single origin, for when wildcard DNS and certificates are not available.
+	GatewayMode string
+
+	CacheEnabled      bool
+	CacheDir          string
+	CacheMaxSizeBytes int64
+
+	// One of "sequential" (default), "race" or "hedged".
+	FetchMode       string
+	FetchHedgeDelay time.Duration
+	FetchAdaptive   bool
+
 	Remotes []Remote
+
+	// Publishers whose tags are served at <label>.<id>.tag.<DomainName> (or /tag/<id>/<label>/ in
+	// path mode), where id is the ID of their public key as printed by ent keygen.
+	Publishers []Publisher
+
+	// Whether to add integrity attributes to the <script> and <link> tags of HTML documents that
+	// refer to other objects in the same DAG.
+	RewriteIntegrity bool
 }
 
 type Remote struct {
 	Name   string
 	URL    string
 	APIKey string
+	// Compressor for gRPC messages, either "gzip" or "zstd"; none by default.
+	Compression string
+}
+
+type Publisher struct {
+	Name string
+	// As printed by ent keygen.
+	PublicKey string
 }
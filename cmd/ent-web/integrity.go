@@ -0,0 +1,175 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/google/ent/dag"
+	"github.com/google/ent/log"
+	"github.com/google/ent/utils"
+	"github.com/multiformats/go-multihash"
+	"golang.org/x/net/html"
+)
+
+// Names of the hash algorithms of the multihash codes that browsers and HTTP clients understand,
+// as used in HTTP Digest Fields (RFC 9530) and in Subresource Integrity respectively.
+var (
+	httpDigestAlgorithms = map[uint64]string{
+		multihash.SHA2_256: "sha-256",
+		multihash.SHA2_512: "sha-512",
+	}
+	integrityAlgorithms = map[uint64]string{
+		multihash.SHA2_256: "sha256",
+		multihash.SHA2_512: "sha512",
+	}
+)
+
+// reprDigest returns the value of the Repr-Digest header (RFC 9530) for an object with the given
+// digest, or false if the hash function is not registered for it.
+func reprDigest(digest utils.Digest) (string, bool) {
+	m, err := multihash.Decode(digest)
+	if err != nil {
+		return "", false
+	}
+	alg, ok := httpDigestAlgorithms[m.Code]
+	if !ok {
+		return "", false
+	}
+	return alg + "=:" + base64.StdEncoding.EncodeToString(m.Digest) + ":", true
+}
+
+// legacyDigest returns the value of the older Digest header (RFC 3230), which some clients still
+// expect instead of Repr-Digest.
+func legacyDigest(digest utils.Digest) (string, bool) {
+	m, err := multihash.Decode(digest)
+	if err != nil {
+		return "", false
+	}
+	alg, ok := httpDigestAlgorithms[m.Code]
+	if !ok {
+		return "", false
+	}
+	return alg + "=" + base64.StdEncoding.EncodeToString(m.Digest), true
+}
+
+// integrity returns the value of an integrity attribute matching the given digest.
+func integrity(digest utils.Digest) (string, bool) {
+	m, err := multihash.Decode(digest)
+	if err != nil {
+		return "", false
+	}
+	alg, ok := integrityAlgorithms[m.Code]
+	if !ok {
+		return "", false
+	}
+	return alg + "-" + base64.StdEncoding.EncodeToString(m.Digest), true
+}
+
+// addIntegrity rewrites the <script src> and <link href> references of an HTML document at the
+// given path in s that point to other raw objects in the same DAG, adding integrity
+// attributes with their digests. References to other origins, and those that cannot be resolved,
+// are left untouched.
+func addIntegrity(ctx context.Context, s site, docPath []string, doc []byte) ([]byte, error) {
+	dir := "/" + strings.Join(docPath[:len(docPath)-1], "/")
+	out := bytes.Buffer{}
+	z := html.NewTokenizer(bytes.NewReader(doc))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() == io.EOF {
+				return out.Bytes(), nil
+			}
+			return nil, z.Err()
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			out.Write(z.Raw())
+			continue
+		}
+		raw := z.Raw()
+		t := z.Token()
+		ref := subresource(t)
+		if ref == "" {
+			out.Write(raw)
+			continue
+		}
+		value, ok := resolveIntegrity(ctx, s, dir, ref)
+		if !ok {
+			out.Write(raw)
+			continue
+		}
+		t.Attr = append(t.Attr, html.Attribute{Key: "integrity", Val: value})
+		out.WriteString(t.String())
+	}
+}
+
+// subresource returns the reference of a tag that supports integrity attributes, if it does not
+// already have one.
+func subresource(t html.Token) string {
+	attrs := map[string]string{}
+	for _, a := range t.Attr {
+		attrs[a.Key] = a.Val
+	}
+	if _, ok := attrs["integrity"]; ok {
+		return ""
+	}
+	switch t.Data {
+	case "script":
+		return attrs["src"]
+	case "link":
+		for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+			switch rel {
+			case "stylesheet", "preload", "modulepreload":
+				return attrs["href"]
+			}
+		}
+	}
+	return ""
+}
+
+// resolveIntegrity resolves a reference relative to dir within the DAG of s, and returns the
+// integrity value for the raw object it points to.
+func resolveIntegrity(ctx context.Context, s site, dir string, ref string) (string, bool) {
+	u, err := url.Parse(ref)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return "", false
+	}
+	p := u.Path
+	if strings.HasPrefix(p, "/") {
+		if !strings.HasPrefix(p, s.base+"/") {
+			return "", false
+		}
+		p = strings.TrimPrefix(p, s.base)
+	} else {
+		p = path.Join(dir, p)
+	}
+	segments := strings.Split(strings.TrimPrefix(path.Clean(p), "/"), "/")
+	target, err := dag.ResolvePath(ctx, objectGetter, s.root, segments)
+	if err != nil {
+		log.Debugf(ctx, "could not resolve %q: %s", ref, err)
+		return "", false
+	}
+	if target.Type() != utils.TypeRaw {
+		return "", false
+	}
+	return integrity(utils.Digest(target.Hash()))
+}
@@ -0,0 +1,121 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/ent/dag"
+	"github.com/google/ent/log"
+	"github.com/google/ent/utils"
+	"github.com/ipfs/go-cid"
+	"golang.org/x/sync/errgroup"
+)
+
+// Maximum number of concurrent metadata lookups when listing a directory.
+const listingConcurrency = 16
+
+// Formats in which objects may be requested, other than the default one meant for browsers.
+const (
+	formatJSON = "json"
+	formatRaw  = "raw"
+)
+
+// Listing is the JSON representation of a directory.
+type Listing struct {
+	CID     string         `json:"cid"`
+	Entries []ListingEntry `json:"entries"`
+}
+
+type ListingEntry struct {
+	Name string `json:"name"`
+	CID  string `json:"cid"`
+	// Either "raw" or "dag".
+	Type string `json:"type"`
+	// Omitted if not known.
+	Size *uint64 `json:"size,omitempty"`
+}
+
+// requestedFormat returns the format requested via the format query parameter or the Accept
+// header, or "" for the default one.
+func requestedFormat(c *gin.Context) string {
+	switch f := c.Query("format"); f {
+	case formatJSON, formatRaw:
+		return f
+	}
+	if strings.Contains(c.GetHeader("Accept"), "application/json") {
+		return formatJSON
+	}
+	return ""
+}
+
+// serveNode serves the serialized directory node itself.
+func serveNode(c *gin.Context, s site, target cid.Cid, nodeRaw []byte) {
+	etag := `"` + target.String() + "." + formatRaw + `"`
+	setCacheHeaders(c, s, etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	setDigestHeaders(c, utils.Digest(target.Hash()))
+	c.Data(http.StatusOK, "application/octet-stream", nodeRaw)
+}
+
+// renderListing serves the entries of the directory node as JSON, with the sizes known to the
+// object getter.
+func renderListing(c *gin.Context, s site, target cid.Cid, node *utils.DAGNode) {
+	// The gin context is not safe for use by the goroutines below.
+	ctx := c.Request.Context()
+	etag := `"` + target.String() + "." + formatJSON + `"`
+	setCacheHeaders(c, s, etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	entries := dag.Entries(node)
+	listing := Listing{
+		CID:     target.String(),
+		Entries: make([]ListingEntry, len(entries)),
+	}
+	// Each size may take a remote call, so they are looked up concurrently.
+	g := errgroup.Group{}
+	g.SetLimit(listingConcurrency)
+	for i, e := range entries {
+		i, e := i, e
+		entry := ListingEntry{
+			Name: e.Name,
+			CID:  e.Link.String(),
+			Type: "raw",
+		}
+		if e.Link.Type() == utils.TypeDAG {
+			entry.Type = "dag"
+		}
+		listing.Entries[i] = entry
+		g.Go(func() error {
+			m, err := objectGetter.GetMetadata(ctx, utils.Digest(e.Link.Hash()))
+			if err == nil {
+				listing.Entries[i].Size = &m.Size
+			} else {
+				log.Debugf(ctx, "could not get metadata for %s: %s", e.Link, err)
+			}
+			return nil
+		})
+	}
+	g.Wait()
+	c.JSON(http.StatusOK, listing)
+}
@@ -0,0 +1,149 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/ent/dag"
+	"github.com/google/ent/utils"
+)
+
+func TestRequestedFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, tc := range []struct {
+		url    string
+		accept string
+		want   string
+	}{
+		{"/", "", ""},
+		{"/", "text/html,application/xhtml+xml", ""},
+		{"/", "application/json", formatJSON},
+		{"/", "text/html;q=0.9, application/json", formatJSON},
+		{"/?format=json", "", formatJSON},
+		{"/?format=raw", "", formatRaw},
+		// The query parameter takes precedence over the header.
+		{"/?format=raw", "application/json", formatRaw},
+		{"/?format=other", "", ""},
+	} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, tc.url, nil)
+		if tc.accept != "" {
+			c.Request.Header.Set("Accept", tc.accept)
+		}
+		if got := requestedFormat(c); got != tc.want {
+			t.Errorf("requestedFormat(%q, Accept: %q) = %q, want %q", tc.url, tc.accept, got, tc.want)
+		}
+	}
+}
+
+func TestRenderListing(t *testing.T) {
+	store := newTestStore(t)
+	router := newTestRouter(t, hostGateway, false)
+	file := putRaw(t, store, "hello")
+	subdir := putDir(t, store)
+	docs := putDir(t, store,
+		dag.Entry{Name: "hello.txt", Link: file},
+		dag.Entry{Name: "sub", Link: subdir},
+	)
+	root := putDir(t, store, dag.Entry{Name: "docs", Link: docs})
+
+	for _, tc := range []struct {
+		path    string
+		headers []string
+	}{
+		{"/docs/", []string{"Accept", "application/json"}},
+		{"/docs/?format=json", nil},
+	} {
+		w := request(router, http.MethodGet, root, tc.path, tc.headers...)
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+		}
+		listing := Listing{}
+		if err := json.Unmarshal(w.Body.Bytes(), &listing); err != nil {
+			t.Fatal(err)
+		}
+		fileSize := uint64(len("hello"))
+		subdirSize := uint64(16)
+		want := Listing{
+			CID: docs.String(),
+			Entries: []ListingEntry{
+				{Name: "hello.txt", CID: file.String(), Type: "raw", Size: &fileSize},
+				{Name: "sub", CID: subdir.String(), Type: "dag", Size: &subdirSize},
+			},
+		}
+		gotJSON, _ := json.Marshal(listing)
+		wantJSON, _ := json.Marshal(want)
+		if !bytes.Equal(gotJSON, wantJSON) {
+			t.Errorf("got listing %s, want %s", gotJSON, wantJSON)
+		}
+		etag := `"` + docs.String() + "." + formatJSON + `"`
+		if got := w.Header().Get("ETag"); got != etag {
+			t.Errorf("got ETag %q, want %q", got, etag)
+		}
+		if got := w.Header().Get("Vary"); got != "Accept" {
+			t.Errorf("got Vary %q, want %q", got, "Accept")
+		}
+
+		w = request(router, http.MethodGet, root, tc.path, append(tc.headers, "If-None-Match", etag)...)
+		if w.Code != http.StatusNotModified {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusNotModified)
+		}
+	}
+}
+
+func TestServeNode(t *testing.T) {
+	store := newTestStore(t)
+	router := newTestRouter(t, hostGateway, false)
+	// Directories with an index file are still available as nodes.
+	root := putDir(t, store, dag.Entry{Name: indexFilename, Link: putRaw(t, store, "<html></html>")})
+	nodeRaw, err := store.Get(context.Background(), utils.Digest(root.Hash()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := request(router, http.MethodGet, root, "/?format=raw")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+	}
+	if !bytes.Equal(w.Body.Bytes(), nodeRaw) {
+		t.Errorf("got %x, want %x", w.Body, nodeRaw)
+	}
+	if got, want := w.Header().Get("Content-Type"), "application/octet-stream"; got != want {
+		t.Errorf("got Content-Type %q, want %q", got, want)
+	}
+	if want, _ := reprDigest(utils.Digest(root.Hash())); w.Header().Get("Repr-Digest") != want {
+		t.Errorf("got Repr-Digest %q, want %q", w.Header().Get("Repr-Digest"), want)
+	}
+	etag := `"` + root.String() + "." + formatRaw + `"`
+	if got := w.Header().Get("ETag"); got != etag {
+		t.Errorf("got ETag %q, want %q", got, etag)
+	}
+
+	w = request(router, http.MethodGet, root, "/?format=raw", "If-None-Match", etag)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusNotModified)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("got body %q, want none", w.Body)
+	}
+}
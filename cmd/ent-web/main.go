@@ -17,15 +17,20 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/gin-gonic/gin"
+	"github.com/google/ent/compression"
+	"github.com/google/ent/dag"
 	"github.com/google/ent/log"
+	"github.com/google/ent/mediatype"
 	"github.com/google/ent/nodeservice"
 	"github.com/google/ent/utils"
 	"github.com/ipfs/go-cid"
@@ -36,11 +41,20 @@ import (
 
 const (
 	wwwSegment = "www"
+	entSegment = "ent"
+
+	hostGateway = "host"
+	pathGateway = "path"
+
+	// Everything under a root CID is immutable, so it may be cached forever.
+	immutableCacheControl = "public, max-age=31536000, immutable"
 )
 
 var (
-	domainName   string
-	objectGetter nodeservice.ObjectGetter
+	domainName       string
+	gatewayMode      string
+	rewriteIntegrity bool
+	objectGetter     nodeservice.ObjectGetter
 )
 
 var configPath = flag.String("config", "", "path to config file")
@@ -58,14 +72,42 @@ func main() {
 	log.Infof(ctx, "loaded config: %#v", config)
 
 	domainName = config.DomainName
+	gatewayMode = config.GatewayMode
+	if gatewayMode == "" {
+		gatewayMode = hostGateway
+	}
+	if gatewayMode != hostGateway && gatewayMode != pathGateway {
+		log.Errorf(ctx, "invalid gateway mode: %q", gatewayMode)
+		return
+	}
+	rewriteIntegrity = config.RewriteIntegrity
 
 	log.InitLog(config.ProjectID)
 
 	objectGetter = getMultiplexObjectGetter(config)
+	err := initTags(ctx, config)
+	if err != nil {
+		log.Errorf(ctx, "could not initialize tags: %v", err)
+		return
+	}
+	if config.CacheEnabled {
+		log.Infof(ctx, "using cache: %q", config.CacheDir)
+		cache, err := nodeservice.NewCache(objectGetter, config.CacheDir, config.CacheMaxSizeBytes)
+		if err != nil {
+			log.Errorf(ctx, "could not open cache: %v", err)
+			return
+		}
+		objectGetter = cache
+	}
 
 	router := gin.Default()
 	router.LoadHTMLGlob("templates/*")
-	router.GET("/*path", webGetHandler)
+	handler := webGetHandler
+	if gatewayMode == pathGateway {
+		handler = pathGetHandler
+	}
+	router.GET("/*path", handler)
+	router.HEAD("/*path", handler)
 
 	s := &http.Server{
 		Addr:           config.ListenAddress,
@@ -87,18 +129,21 @@ func webGetHandler(c *gin.Context) {
 		pathSegments := strings.Split(strings.TrimPrefix(c.Param("path"), "/"), "/")
 		log.Warningf(ctx, "path segments: %#v", pathSegments)
 		if len(pathSegments) == 1 {
-			base := pathSegments[0]
-			digest, err := utils.ParseDigest(base)
+			link, err := digestLink(pathSegments[0])
 			if err != nil {
 				log.Warningf(ctx, "could not parse digest: %s", err)
 				c.AbortWithStatus(http.StatusNotFound)
 				return
 			}
-			link := cid.NewCidV1(utils.TypeDAG, multihash.Multihash(digest))
 			c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("http://%s.www.%s", link.String(), domainName))
 			return
 		}
 	}
+	if len(hostSegments) == 3 && hostSegments[2] == tagSegment {
+		path := strings.Split(strings.TrimPrefix(c.Param("path"), "/"), "/")
+		serveTag(c, hostSegments[1], hostSegments[0], "", path)
+		return
+	}
 	if len(hostSegments) != 2 {
 		log.Warningf(ctx, "invalid host segments: %#v", hostSegments)
 		c.AbortWithStatus(http.StatusNotFound)
@@ -118,53 +163,281 @@ func webGetHandler(c *gin.Context) {
 	}
 
 	path := strings.Split(strings.TrimPrefix(c.Param("path"), "/"), "/")
-	log.Debugf(ctx, "root link: %s", rootLink.String())
-	log.Debugf(ctx, "path: %#v", path)
-	target, err := traverseString(ctx, objectGetter, rootLink, path)
+	serveSite(c, newSite(rootLink), path)
+}
+
+// pathGetHandler serves roots under /ent/<cid>/ on a single origin, for deployments without
+// wildcard DNS. Unlike webGetHandler, sites are not isolated from each other.
+func pathGetHandler(c *gin.Context) {
+	ctx := c
+	segments := strings.Split(strings.TrimPrefix(c.Param("path"), "/"), "/")
+	if len(segments) == 1 {
+		link, err := digestLink(segments[0])
+		if err != nil {
+			log.Warningf(ctx, "could not parse digest: %s", err)
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		c.Redirect(http.StatusMovedPermanently, basePath(link)+"/")
+		return
+	}
+	if segments[0] == tagSegment && len(segments) >= 3 {
+		if len(segments) == 3 {
+			u := *c.Request.URL
+			u.Path += "/"
+			c.Redirect(http.StatusMovedPermanently, u.String())
+			return
+		}
+		base := "/" + strings.Join(segments[:3], "/")
+		serveTag(c, segments[1], segments[2], base, segments[3:])
+		return
+	}
+	if segments[0] != entSegment {
+		log.Warningf(ctx, "invalid path segments: %#v", segments)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	rootLink, err := cid.Parse(segments[1])
 	if err != nil {
-		log.Warningf(ctx, "could not traverse: %s", err)
+		log.Warningf(ctx, "could not parse root link from %q: %s", segments[1], err)
 		c.AbortWithStatus(http.StatusNotFound)
 		return
 	}
-	log.Debugf(ctx, "target: %s", target.String())
-	c.Header("ent-digest", target.String())
-	nodeRaw, err := objectGetter.Get(ctx, utils.Digest(target.Hash()))
+	if len(segments) == 2 {
+		// Relative references are resolved against the root directory.
+		u := *c.Request.URL
+		u.Path += "/"
+		c.Redirect(http.StatusMovedPermanently, u.String())
+		return
+	}
+	serveSite(c, newSite(rootLink), segments[2:])
+}
+
+// site is a DAG being served, and how.
+type site struct {
+	root cid.Cid
+	// URL path under which the root is served, without a trailing slash.
+	base         string
+	cacheControl string
+}
+
+// newSite returns the site for a DAG requested by CID.
+func newSite(root cid.Cid) site {
+	return site{
+		root:         root,
+		base:         basePath(root),
+		cacheControl: immutableCacheControl,
+	}
+}
+
+// serveSite serves the object at the given path under the root of s.
+func serveSite(c *gin.Context, s site, path []string) {
+	ctx := c
+	log.Debugf(ctx, "root link: %s", s.root.String())
+	log.Debugf(ctx, "path: %#v", path)
+	target, err := dag.ResolvePath(ctx, objectGetter, s.root, path)
+	if errors.Is(err, dag.ErrPathNotFound) {
+		log.Debugf(ctx, "could not traverse: %s", err)
+		serveNotFound(c, s, path)
+		return
+	}
 	if err != nil {
-		log.Warningf(ctx, "could not get blob %s: %s", target, err)
-		c.Abort()
+		log.Warningf(ctx, "could not traverse: %s", err)
+		serveUnavailable(c)
 		return
 	}
+	log.Debugf(ctx, "target: %s", target.String())
 	switch target.Type() {
 	case utils.TypeRaw:
-		contentType := http.DetectContentType(nodeRaw)
-		log.Debugf(ctx, "content type: %s", contentType)
-		c.Data(http.StatusOK, contentType, nodeRaw)
+		serveRaw(c, s, target, path[len(path)-1], path, http.StatusOK)
 	case utils.TypeDAG:
-		renderDag(c, rootLink, target, nodeRaw, path)
+		serveDir(c, s, target, path)
 	default:
-		log.Warningf(ctx, "invalid target type: %s", target.Type())
+		log.Warningf(ctx, "invalid target type: %d", target.Type())
 		c.AbortWithStatus(http.StatusNotFound)
 	}
 }
 
-func renderDag(c *gin.Context, root cid.Cid, target cid.Cid, nodeRaw []byte, path []string) {
+// serveUnavailable responds to a request that could not be served because the objects it needs
+// could not be fetched. Since they may be available later, the response must not be cached.
+func serveUnavailable(c *gin.Context) {
+	c.AbortWithStatus(http.StatusBadGateway)
+}
+
+// digestLink returns the link to the DAG with the given digest.
+func digestLink(s string) (cid.Cid, error) {
+	digest, err := utils.ParseDigest(s)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	return cid.NewCidV1(utils.TypeDAG, multihash.Multihash(digest)), nil
+}
+
+// basePath returns the URL path under which the DAG at root is served, without a trailing slash.
+func basePath(root cid.Cid) string {
+	if gatewayMode == pathGateway {
+		return "/" + entSegment + "/" + root.String()
+	}
+	return ""
+}
+
+// serveRaw serves the raw object target of s with the given status. The name is used to
+// detect its media type, and reqPath is the path it was requested at.
+func serveRaw(c *gin.Context, s site, target cid.Cid, name string, reqPath []string, status int) {
+	ctx := c
+	c.Header("ent-digest", target.String())
+	etag := `"` + target.String() + `"`
+	// Rewritten documents have their own ETag, which is only known once they are rewritten.
+	rewrite := mayRewrite(name) && requestedFormat(c) != formatRaw
+	if status == http.StatusOK && !rewrite && etagMatches(c.GetHeader("If-None-Match"), etag) {
+		setCacheHeaders(c, s, etag)
+		c.Status(http.StatusNotModified)
+		return
+	}
+	// HEAD requests are answered like GET requests, since the media type is detected from the
+	// contents, and the media type recorded by remotes may have been detected differently (e.g. by
+	// an index, from the URL the object was found at).
+	nodeRaw, err := objectGetter.Get(ctx, utils.Digest(target.Hash()))
+	if err != nil {
+		log.Warningf(ctx, "could not get blob %s: %s", target, err)
+		serveUnavailable(c)
+		return
+	}
+	contentType := mediatype.Detect(name, "", nodeRaw)
+	log.Debugf(ctx, "content type: %s", contentType)
+	body := nodeRaw
+	digest := utils.Digest(target.Hash())
+	if rewriteIntegrity && strings.HasPrefix(contentType, "text/html") && requestedFormat(c) != formatRaw {
+		b, err := addIntegrity(ctx, s, reqPath, nodeRaw)
+		if err != nil {
+			log.Warningf(ctx, "could not add integrity attributes: %s", err)
+		} else {
+			body = b
+			digest = utils.ComputeDigest(b)
+			etag = `"` + cid.NewCidV1(utils.TypeRaw, multihash.Multihash(digest)).String() + `"`
+		}
+	}
+	if status == http.StatusOK && rewrite && etagMatches(c.GetHeader("If-None-Match"), etag) {
+		setCacheHeaders(c, s, etag)
+		c.Status(http.StatusNotModified)
+		return
+	}
+	// The digest headers describe the representation, so they are not affected by compression.
+	setDigestHeaders(c, digest)
+	body, coding := compression.EncodeResponse(c.GetHeader("Accept-Encoding"), body)
+	c.Writer.Header().Add("Vary", "Accept-Encoding")
+	if coding != "" {
+		c.Header("Content-Encoding", coding)
+		// The compressed bytes are not guaranteed to be the same across responses.
+		etag = "W/" + etag
+	}
+	setCacheHeaders(c, s, etag)
+	c.Header("Content-Length", strconv.Itoa(len(body)))
+	c.Data(status, contentType, body)
+}
+
+// serveDir serves the index.html file of the directory target if it has one, or otherwise a
+// listing of its entries.
+func serveDir(c *gin.Context, s site, target cid.Cid, path []string) {
 	ctx := c
+	nodeRaw, err := objectGetter.Get(ctx, utils.Digest(target.Hash()))
+	if err != nil {
+		log.Warningf(ctx, "could not get blob %s: %s", target, err)
+		serveUnavailable(c)
+		return
+	}
 	node, err := utils.ParseDAGNode(nodeRaw)
 	if err != nil {
 		log.Warningf(ctx, "could not parse dag node: %s", err)
 		c.AbortWithStatus(http.StatusNotFound)
 		return
 	}
+	c.Header("Vary", "Accept")
+	switch requestedFormat(c) {
+	case formatRaw:
+		c.Header("ent-digest", target.String())
+		serveNode(c, s, target, nodeRaw)
+		return
+	case formatJSON:
+		c.Header("ent-digest", target.String())
+		renderListing(c, s, target, node)
+		return
+	}
+	for _, e := range dag.Entries(node) {
+		if e.Name != indexFilename || e.Link.Type() != utils.TypeRaw {
+			continue
+		}
+		if path[len(path)-1] != "" {
+			// Relative references in the index file are resolved against the directory.
+			u := *c.Request.URL
+			u.Path += "/"
+			c.Redirect(http.StatusMovedPermanently, u.String())
+			return
+		}
+		serveRaw(c, s, e.Link, indexFilename, path, http.StatusOK)
+		return
+	}
+	c.Header("ent-digest", target.String())
+	etag := `"` + target.String() + `"`
+	setCacheHeaders(c, s, etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	renderDag(c, s, target, node, path)
+}
+
+// mayRewrite returns whether the object with the given name may be served with different contents
+// than those stored, in which case its metadata cannot be used to describe the response.
+func mayRewrite(name string) bool {
+	if !rewriteIntegrity {
+		return false
+	}
+	t := mediatype.ByName(name)
+	return t == "" || strings.HasPrefix(t, "text/html")
+}
+
+func setCacheHeaders(c *gin.Context, s site, etag string) {
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", s.cacheControl)
+}
+
+// setDigestHeaders sets the headers that allow clients to verify the response against the digest,
+// if its hash function is one they understand.
+func setDigestHeaders(c *gin.Context, digest utils.Digest) {
+	if v, ok := reprDigest(digest); ok {
+		c.Header("Repr-Digest", v)
+	}
+	if v, ok := legacyDigest(digest); ok {
+		c.Header("Digest", v)
+	}
+}
 
+// etagMatches returns whether the value of an If-None-Match header matches etag, using the weak
+// comparison required for that header.
+func etagMatches(header string, etag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, v := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(v), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func renderDag(c *gin.Context, s site, target cid.Cid, node *utils.DAGNode, path []string) {
+	base := s.base
 	parents := []UILink{}
 	parents = append(parents, UILink{
-		Name: root.String(),
-		URL:  "/",
+		Name: s.root.String(),
+		URL:  base + "/",
 	})
 	for i, s := range path {
 		parents = append(parents, UILink{
 			Name: s,
-			URL:  "/" + strings.Join(path[:i+1], "/"),
+			URL:  base + "/" + strings.Join(path[:i+1], "/"),
 		})
 	}
 
@@ -178,7 +451,7 @@ func renderDag(c *gin.Context, root cid.Cid, target cid.Cid, nodeRaw []byte, pat
 		links = append(links, UILink{
 			Name: names[i],
 			Raw:  link.Type() == utils.TypeRaw,
-			URL:  prefix + names[i],
+			URL:  base + prefix + names[i],
 		})
 	}
 
@@ -206,62 +479,43 @@ func hostSegments(host string) []string {
 	}
 }
 
-func traverseString(ctx context.Context, og nodeservice.ObjectGetter, link cid.Cid, segments []string) (cid.Cid, error) {
-	if len(segments) == 0 || link.Type() == utils.TypeRaw {
-		return link, nil
-	} else {
-		digest := utils.Digest(link.Hash())
-		nodeRaw, err := og.Get(ctx, digest)
-		if err != nil {
-			return cid.Cid{}, fmt.Errorf("could not get blob %s: %w", digest, err)
-		}
-		node, err := utils.ParseDAGNode(nodeRaw)
-		if err != nil {
-			return cid.Cid{}, fmt.Errorf("could not parse node %s: %w", digest, err)
-		}
-		selector := segments[0]
-		if selector != "" {
-			names := strings.Split(string(node.Bytes), "\n")
-			// Find the name corresponding to the selector
-			log.Debugf(ctx, "selector: %v", selector)
-			log.Debugf(ctx, "names: %#v", names)
-			linkIndex := -1
-			for i, name := range names {
-				if name == selector {
-					linkIndex = i
-					break
-				}
-			}
-			if linkIndex == -1 {
-				return cid.Cid{}, fmt.Errorf("could not find link %s/%v", digest, selector)
-			}
-			next := node.Links[linkIndex]
-			if err != nil {
-				return cid.Cid{}, fmt.Errorf("could not traverse %s/%v: %w", digest, selector, err)
-			}
-			log.Debugf(ctx, "next: %v", next)
-			return traverseString(ctx, og, next, segments[1:])
-		} else {
-			return link, nil
-		}
-	}
-}
-
 func readConfig() Config {
 	config := Config{}
 	_, err := toml.DecodeFile(*configPath, &config)
 	if err != nil {
 		panic(err)
 	}
+	for _, remote := range config.Remotes {
+		err := compression.CheckGRPCCompressor(remote.Compression)
+		if err != nil {
+			panic(fmt.Errorf("invalid compression for remote %q: %w", remote.Name, err))
+		}
+	}
 	return config
 }
 
 func getMultiplexObjectGetter(config Config) nodeservice.ObjectGetter {
 	inner := make([]nodeservice.Inner, 0)
 	for _, remote := range config.Remotes {
-		inner = append(inner, nodeservice.NewRemote(remote.Name, remote.URL, remote.APIKey))
+		r, err := nodeservice.NewRemote(remote.Name, remote.URL, remote.APIKey, nodeservice.WithCompressor(remote.Compression)...)
+		if err != nil {
+			log.Errorf(context.Background(), "skipping remote: %v", err)
+			continue
+		}
+		inner = append(inner, r)
+	}
+	mode, err := nodeservice.ParseFetchMode(config.FetchMode)
+	if err != nil {
+		log.Errorf(context.Background(), "could not parse fetch mode: %v", err)
+	}
+	var stats *nodeservice.Stats
+	if config.FetchAdaptive {
+		stats = nodeservice.NewStats()
 	}
 	return nodeservice.Sequence{
-		Inner: inner,
+		Inner:      inner,
+		Mode:       mode,
+		HedgeDelay: config.FetchHedgeDelay,
+		Stats:      stats,
 	}
 }
@@ -0,0 +1,403 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/ent/dag"
+	"github.com/google/ent/datastore"
+	"github.com/google/ent/objectstore"
+	"github.com/google/ent/utils"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+const testDomain = "example.com"
+
+// newTestStore returns an empty in-memory object store, and installs it as the object getter for
+// the duration of the test.
+func newTestStore(t *testing.T) objectstore.Store {
+	store := objectstore.Store{
+		Inner: datastore.InMemory{
+			Inner: map[string][]byte{},
+		},
+	}
+	old := objectGetter
+	objectGetter = store
+	t.Cleanup(func() { objectGetter = old })
+	return store
+}
+
+// newTestRouter returns a router serving the given gateway mode, with a template for listings
+// that renders one link URL per line.
+func newTestRouter(t *testing.T, mode string, rewrite bool) *gin.Engine {
+	oldDomain, oldMode, oldRewrite := domainName, gatewayMode, rewriteIntegrity
+	domainName, gatewayMode, rewriteIntegrity = testDomain, mode, rewrite
+	t.Cleanup(func() { domainName, gatewayMode, rewriteIntegrity = oldDomain, oldMode, oldRewrite })
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.SetHTMLTemplate(template.Must(template.New("basic.html").Parse("{{range .links}}{{.URL}}\n{{end}}")))
+	handler := webGetHandler
+	if mode == pathGateway {
+		handler = pathGetHandler
+	}
+	router.GET("/*path", handler)
+	router.HEAD("/*path", handler)
+	return router
+}
+
+func putRaw(t *testing.T, store objectstore.Store, b string) cid.Cid {
+	digest, err := store.Put(context.Background(), []byte(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cid.NewCidV1(utils.TypeRaw, multihash.Multihash(digest))
+}
+
+func putDir(t *testing.T, store objectstore.Store, entries ...dag.Entry) cid.Cid {
+	b, err := utils.SerializeDAGNode(dag.NewNode(entries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := store.Put(context.Background(), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cid.NewCidV1(utils.TypeDAG, multihash.Multihash(digest))
+}
+
+// request sends a request for the URL path p to the site of root; in host mode the root is
+// part of the host, and in path mode it is prepended to p. The headers are given as name and value
+// pairs.
+func request(router *gin.Engine, method string, root cid.Cid, p string, headers ...string) *httptest.ResponseRecorder {
+	host := root.String() + "." + wwwSegment + "." + testDomain
+	if gatewayMode == pathGateway {
+		host = testDomain
+		p = basePath(root) + p
+	}
+	return requestHost(router, method, host, p, headers...)
+}
+
+func requestHost(router *gin.Engine, method string, host string, p string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, p, nil)
+	req.Host = host
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestDigestHeaders(t *testing.T) {
+	store := newTestStore(t)
+	router := newTestRouter(t, hostGateway, false)
+	content := "hello world"
+	file := putRaw(t, store, content)
+	root := putDir(t, store, dag.Entry{Name: "hello.txt", Link: file})
+
+	sum := sha256.Sum256([]byte(content))
+	encoded := base64.StdEncoding.EncodeToString(sum[:])
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		w := request(router, method, root, "/hello.txt")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d, want %d", method, w.Code, http.StatusOK)
+		}
+		if got, want := w.Header().Get("Repr-Digest"), "sha-256=:"+encoded+":"; got != want {
+			t.Errorf("%s: got Repr-Digest %q, want %q", method, got, want)
+		}
+		if got, want := w.Header().Get("Digest"), "sha-256="+encoded; got != want {
+			t.Errorf("%s: got Digest %q, want %q", method, got, want)
+		}
+		if got, want := w.Header().Get("ETag"), `"`+file.String()+`"`; got != want {
+			t.Errorf("%s: got ETag %q, want %q", method, got, want)
+		}
+	}
+}
+
+func TestHeadContentType(t *testing.T) {
+	store := newTestStore(t)
+	router := newTestRouter(t, hostGateway, false)
+	files := map[string]string{
+		"app.js":    "console.log('hi');",
+		"data":      `{"a": 1}`,
+		"image.txt": "\x89PNG\r\n\x1a\n",
+	}
+	entries := []dag.Entry{}
+	for name, content := range files {
+		entries = append(entries, dag.Entry{Name: name, Link: putRaw(t, store, content)})
+	}
+	root := putDir(t, store, entries...)
+
+	for name := range files {
+		get := request(router, http.MethodGet, root, "/"+name)
+		head := request(router, http.MethodHead, root, "/"+name)
+		if got, want := head.Header().Get("Content-Type"), get.Header().Get("Content-Type"); got != want {
+			t.Errorf("%s: got HEAD Content-Type %q, want %q as for GET", name, got, want)
+		}
+		if got, want := head.Header().Get("Content-Length"), get.Header().Get("Content-Length"); got != want {
+			t.Errorf("%s: got HEAD Content-Length %q, want %q as for GET", name, got, want)
+		}
+	}
+}
+
+func TestIfNoneMatch(t *testing.T) {
+	store := newTestStore(t)
+	router := newTestRouter(t, hostGateway, false)
+	file := putRaw(t, store, "hello world")
+	root := putDir(t, store, dag.Entry{Name: "hello.txt", Link: file})
+	etag := `"` + file.String() + `"`
+
+	for _, tc := range []struct {
+		ifNoneMatch string
+		want        int
+	}{
+		{etag, http.StatusNotModified},
+		{"W/" + etag, http.StatusNotModified},
+		{`"other", ` + etag, http.StatusNotModified},
+		{"*", http.StatusNotModified},
+		{`"other"`, http.StatusOK},
+	} {
+		w := request(router, http.MethodGet, root, "/hello.txt", "If-None-Match", tc.ifNoneMatch)
+		if w.Code != tc.want {
+			t.Errorf("If-None-Match %s: got status %d, want %d", tc.ifNoneMatch, w.Code, tc.want)
+		}
+		if tc.want == http.StatusNotModified && w.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: got body %q, want none", tc.ifNoneMatch, w.Body)
+		}
+		if got := w.Header().Get("ETag"); got != etag {
+			t.Errorf("If-None-Match %s: got ETag %q, want %q", tc.ifNoneMatch, got, etag)
+		}
+	}
+}
+
+func integrityAttr(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return `integrity="sha256-` + base64.StdEncoding.EncodeToString(sum[:]) + `"`
+}
+
+func TestRewriteIntegrity(t *testing.T) {
+	script := "console.log('hi');"
+	style := "body {}"
+	page := `<html><head>` +
+		`<script src="../app.js"></script>` +
+		`<link rel="stylesheet" href="/css/style.css">` +
+		`<link rel="icon" href="/css/style.css">` +
+		`<script src="https://cdn.example.com/lib.js"></script>` +
+		`<script src="missing.js"></script>` +
+		`</head></html>`
+
+	for _, mode := range []string{hostGateway, pathGateway} {
+		t.Run(mode, func(t *testing.T) {
+			store := newTestStore(t)
+			router := newTestRouter(t, mode, true)
+			pageLink := putRaw(t, store, page)
+			root := putDir(t, store,
+				dag.Entry{Name: "app.js", Link: putRaw(t, store, script)},
+				dag.Entry{Name: "css", Link: putDir(t, store, dag.Entry{Name: "style.css", Link: putRaw(t, store, style)})},
+				dag.Entry{Name: "docs", Link: putDir(t, store, dag.Entry{Name: "page.html", Link: pageLink})},
+			)
+
+			w := request(router, http.MethodGet, root, "/docs/page.html")
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+			}
+			body := w.Body.String()
+			// Relative references are resolved against the directory of the document.
+			if want := `<script src="../app.js" ` + integrityAttr(script) + `>`; !strings.Contains(body, want) {
+				t.Errorf("got %q, want it to contain %q", body, want)
+			}
+			// Absolute references are resolved against the root of the site, which in path mode is
+			// not the root of the origin.
+			stylesheet := `<link rel="stylesheet" href="/css/style.css" ` + integrityAttr(style) + `>`
+			if got := strings.Contains(body, stylesheet); got != (mode == hostGateway) {
+				t.Errorf("got %q, want it to contain %q: %t", body, stylesheet, mode == hostGateway)
+			}
+			for _, unchanged := range []string{
+				`<link rel="icon" href="/css/style.css">`,
+				`<script src="https://cdn.example.com/lib.js">`,
+				`<script src="missing.js">`,
+			} {
+				if !strings.Contains(body, unchanged) {
+					t.Errorf("got %q, want it to contain %q", body, unchanged)
+				}
+			}
+
+			// The rewritten document is described by its own digest and ETag.
+			sum := sha256.Sum256(w.Body.Bytes())
+			if got, want := w.Header().Get("Repr-Digest"), "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":"; got != want {
+				t.Errorf("got Repr-Digest %q, want %q", got, want)
+			}
+			etag := w.Header().Get("ETag")
+			if etag == `"`+pageLink.String()+`"` {
+				t.Errorf("got ETag %q of the stored document for the rewritten one", etag)
+			}
+			w = request(router, http.MethodGet, root, "/docs/page.html", "If-None-Match", etag)
+			if w.Code != http.StatusNotModified {
+				t.Errorf("got status %d for the rewritten ETag, want %d", w.Code, http.StatusNotModified)
+			}
+			w = request(router, http.MethodGet, root, "/docs/page.html", "If-None-Match", `"`+pageLink.String()+`"`)
+			if w.Code != http.StatusOK {
+				t.Errorf("got status %d for the stored ETag, want %d", w.Code, http.StatusOK)
+			}
+
+			// The stored document is still available as is.
+			w = request(router, http.MethodGet, root, "/docs/page.html?format=raw")
+			if w.Body.String() != page {
+				t.Errorf("got %q, want %q", w.Body, page)
+			}
+			if got, want := w.Header().Get("ETag"), `"`+pageLink.String()+`"`; got != want {
+				t.Errorf("got ETag %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestGatewayRouting(t *testing.T) {
+	for _, mode := range []string{hostGateway, pathGateway} {
+		t.Run(mode, func(t *testing.T) {
+			store := newTestStore(t)
+			router := newTestRouter(t, mode, false)
+			root := putDir(t, store,
+				dag.Entry{Name: "hello.txt", Link: putRaw(t, store, "hello")},
+				dag.Entry{Name: "docs", Link: putDir(t, store, dag.Entry{Name: indexFilename, Link: putRaw(t, store, "<html></html>")})},
+			)
+			base := basePath(root)
+			rootHost := root.String() + "." + wwwSegment + "." + testDomain
+
+			for _, tc := range []struct {
+				host         string
+				path         string
+				wantStatus   int
+				wantBody     string
+				wantLocation string
+			}{
+				// Digests are redirected to the root of their DAG.
+				{
+					host:         testDomain,
+					path:         "/" + utils.DigestToHumanString(utils.Digest(root.Hash())),
+					wantStatus:   http.StatusMovedPermanently,
+					wantLocation: map[string]string{hostGateway: "http://" + rootHost, pathGateway: base + "/"}[mode],
+				},
+				{
+					host:       testDomain,
+					path:       "/invalid",
+					wantStatus: http.StatusNotFound,
+				},
+				{
+					host:       rootHost,
+					path:       "/hello.txt",
+					wantStatus: map[string]int{hostGateway: http.StatusOK, pathGateway: http.StatusNotFound}[mode],
+					wantBody:   map[string]string{hostGateway: "hello"}[mode],
+				},
+				// Relative references in index files are resolved against their directory.
+				{
+					host:         rootHost,
+					path:         "/docs",
+					wantStatus:   map[string]int{hostGateway: http.StatusMovedPermanently, pathGateway: http.StatusNotFound}[mode],
+					wantLocation: map[string]string{hostGateway: "/docs/"}[mode],
+				},
+				{
+					host:       testDomain,
+					path:       "/" + entSegment + "/" + root.String() + "/hello.txt",
+					wantStatus: map[string]int{hostGateway: http.StatusNotFound, pathGateway: http.StatusOK}[mode],
+					wantBody:   map[string]string{pathGateway: "hello"}[mode],
+				},
+				// Relative references are resolved against the root directory, so it must be
+				// requested with a trailing slash.
+				{
+					host:         testDomain,
+					path:         "/" + entSegment + "/" + root.String(),
+					wantStatus:   map[string]int{hostGateway: http.StatusNotFound, pathGateway: http.StatusMovedPermanently}[mode],
+					wantLocation: map[string]string{pathGateway: "/" + entSegment + "/" + root.String() + "/"}[mode],
+				},
+				{
+					host:         testDomain,
+					path:         "/" + entSegment + "/" + root.String() + "/docs",
+					wantStatus:   map[string]int{hostGateway: http.StatusNotFound, pathGateway: http.StatusMovedPermanently}[mode],
+					wantLocation: map[string]string{pathGateway: "/" + entSegment + "/" + root.String() + "/docs/"}[mode],
+				},
+				{
+					host:       testDomain,
+					path:       "/" + entSegment + "/invalid/hello.txt",
+					wantStatus: http.StatusNotFound,
+				},
+				{
+					host:       testDomain,
+					path:       "/other/" + root.String() + "/hello.txt",
+					wantStatus: http.StatusNotFound,
+				},
+				{
+					host:         testDomain,
+					path:         "/" + tagSegment + "/publisher/label",
+					wantStatus:   map[string]int{hostGateway: http.StatusNotFound, pathGateway: http.StatusMovedPermanently}[mode],
+					wantLocation: map[string]string{pathGateway: "/" + tagSegment + "/publisher/label/"}[mode],
+				},
+			} {
+				w := requestHost(router, http.MethodGet, tc.host, tc.path)
+				if w.Code != tc.wantStatus {
+					t.Errorf("%s%s: got status %d, want %d", tc.host, tc.path, w.Code, tc.wantStatus)
+					continue
+				}
+				if tc.wantBody != "" && w.Body.String() != tc.wantBody {
+					t.Errorf("%s%s: got body %q, want %q", tc.host, tc.path, w.Body, tc.wantBody)
+				}
+				if got := w.Header().Get("Location"); got != tc.wantLocation {
+					t.Errorf("%s%s: got Location %q, want %q", tc.host, tc.path, got, tc.wantLocation)
+				}
+			}
+		})
+	}
+}
+
+func TestListingLinks(t *testing.T) {
+	for _, mode := range []string{hostGateway, pathGateway} {
+		t.Run(mode, func(t *testing.T) {
+			store := newTestStore(t)
+			router := newTestRouter(t, mode, false)
+			root := putDir(t, store,
+				dag.Entry{Name: "docs", Link: putDir(t, store,
+					dag.Entry{Name: "a.txt", Link: putRaw(t, store, "a")},
+					dag.Entry{Name: "b", Link: putDir(t, store)},
+				)},
+			)
+			// Links are absolute, and include the base path of the root in path mode.
+			base := map[string]string{hostGateway: "", pathGateway: "/" + entSegment + "/" + root.String()}[mode]
+
+			w := request(router, http.MethodGet, root, "/docs/")
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+			}
+			if got, want := w.Body.String(), base+"/docs/a.txt\n"+base+"/docs/b\n"; got != want {
+				t.Errorf("got links %q, want %q", got, want)
+			}
+			w = request(router, http.MethodGet, root, "/")
+			if got, want := w.Body.String(), base+"/docs\n"; got != want {
+				t.Errorf("got links %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/ent/dag"
+	"github.com/google/ent/log"
+	"github.com/google/ent/utils"
+)
+
+const (
+	// Served in place of a directory listing.
+	indexFilename = "index.html"
+	// Served with a 404 status for paths that do not exist, unless the site manifest says otherwise.
+	notFoundFilename = "404.html"
+	// Optional file at the root of a DAG that configures how it is served as a site.
+	siteManifestFilename = "ent-web.json"
+)
+
+// SiteManifest configures how paths that do not exist in a DAG are handled. Paths are relative to
+// the root of the DAG.
+type SiteManifest struct {
+	// Document served with a 404 status; defaults to 404.html.
+	NotFound string `json:"notFound"`
+	// If set, document served with a 200 status instead, so that single page applications can
+	// handle their routes client-side; usually index.html.
+	Fallback string `json:"fallback"`
+}
+
+// readSiteManifest returns the manifest at the root of the DAG, or the default one if there is none
+// or it is invalid. An error is only returned if the manifest could not be fetched.
+func readSiteManifest(c *gin.Context, s site) (SiteManifest, error) {
+	ctx := c
+	m := SiteManifest{
+		NotFound: notFoundFilename,
+	}
+	link, err := dag.ResolvePath(ctx, objectGetter, s.root, []string{siteManifestFilename})
+	if errors.Is(err, dag.ErrPathNotFound) {
+		return m, nil
+	}
+	if err != nil {
+		return m, fmt.Errorf("could not resolve site manifest: %w", err)
+	}
+	if link.Type() != utils.TypeRaw {
+		return m, nil
+	}
+	b, err := objectGetter.Get(ctx, utils.Digest(link.Hash()))
+	if err != nil {
+		return m, fmt.Errorf("could not get site manifest %s: %w", link, err)
+	}
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		log.Warningf(ctx, "could not parse site manifest %s: %s", link, err)
+		return SiteManifest{
+			NotFound: notFoundFilename,
+		}, nil
+	}
+	return m, nil
+}
+
+// serveNotFound responds to a request for a path that does not exist in s, with the fallback
+// or not found document of the site if it has one.
+func serveNotFound(c *gin.Context, s site, reqPath []string) {
+	ctx := c
+	m, err := readSiteManifest(c, s)
+	if err != nil {
+		log.Warningf(ctx, "%s", err)
+		serveUnavailable(c)
+		return
+	}
+	for _, d := range []struct {
+		name   string
+		status int
+	}{
+		{m.Fallback, http.StatusOK},
+		{m.NotFound, http.StatusNotFound},
+	} {
+		if d.name == "" {
+			continue
+		}
+		segments := strings.Split(strings.TrimPrefix(path.Clean("/"+d.name), "/"), "/")
+		link, err := dag.ResolvePath(ctx, objectGetter, s.root, segments)
+		if errors.Is(err, dag.ErrPathNotFound) {
+			log.Debugf(ctx, "could not resolve %q: %v", d.name, err)
+			continue
+		}
+		if err != nil {
+			log.Warningf(ctx, "could not resolve %q: %v", d.name, err)
+			serveUnavailable(c)
+			return
+		}
+		if link.Type() != utils.TypeRaw {
+			continue
+		}
+		serveRaw(c, s, link, segments[len(segments)-1], reqPath, d.status)
+		return
+	}
+	c.AbortWithStatus(http.StatusNotFound)
+}
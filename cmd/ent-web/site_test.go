@@ -0,0 +1,191 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/ent/dag"
+	"github.com/google/ent/objectstore"
+	"github.com/google/ent/utils"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+func TestServeSite(t *testing.T) {
+	const (
+		index    = "<html>index</html>"
+		docs     = "<html>docs</html>"
+		notFound = "<html>not found</html>"
+		missing  = "<html>missing</html>"
+	)
+	// Links to objects that are not in the store.
+	absent := cid.NewCidV1(utils.TypeDAG, multihash.Multihash(utils.ComputeDigest([]byte("absent"))))
+	absentRaw := cid.NewCidV1(utils.TypeRaw, multihash.Multihash(utils.ComputeDigest([]byte("absent"))))
+
+	for _, tc := range []struct {
+		name string
+		// Entries of the root directory, in addition to index.html and docs/index.html.
+		entries    func(t *testing.T, store objectstore.Store) []dag.Entry
+		path       string
+		wantStatus int
+		wantBody   string
+		// Location header of redirects.
+		wantLocation string
+	}{
+		{
+			name:       "root index",
+			path:       "/",
+			wantStatus: http.StatusOK,
+			wantBody:   index,
+		},
+		{
+			name:       "directory index",
+			path:       "/docs/",
+			wantStatus: http.StatusOK,
+			wantBody:   docs,
+		},
+		{
+			name:         "trailing slash redirect",
+			path:         "/docs",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "/docs/",
+		},
+		{
+			name:       "no 404.html",
+			path:       "/missing",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "404.html",
+			entries: func(t *testing.T, store objectstore.Store) []dag.Entry {
+				return []dag.Entry{{Name: notFoundFilename, Link: putRaw(t, store, notFound)}}
+			},
+			path:       "/missing/page",
+			wantStatus: http.StatusNotFound,
+			wantBody:   notFound,
+		},
+		{
+			name: "manifest fallback",
+			entries: func(t *testing.T, store objectstore.Store) []dag.Entry {
+				return []dag.Entry{
+					{Name: notFoundFilename, Link: putRaw(t, store, notFound)},
+					{Name: siteManifestFilename, Link: putRaw(t, store, `{"fallback": "index.html"}`)},
+				}
+			},
+			path:       "/app/route",
+			wantStatus: http.StatusOK,
+			wantBody:   index,
+		},
+		{
+			name: "manifest not found document",
+			entries: func(t *testing.T, store objectstore.Store) []dag.Entry {
+				return []dag.Entry{
+					{Name: notFoundFilename, Link: putRaw(t, store, notFound)},
+					{Name: "errors", Link: putDir(t, store, dag.Entry{Name: "missing.html", Link: putRaw(t, store, missing)})},
+					{Name: siteManifestFilename, Link: putRaw(t, store, `{"notFound": "/errors/missing.html"}`)},
+				}
+			},
+			path:       "/missing",
+			wantStatus: http.StatusNotFound,
+			wantBody:   missing,
+		},
+		{
+			name: "manifest fallback that does not exist",
+			entries: func(t *testing.T, store objectstore.Store) []dag.Entry {
+				return []dag.Entry{
+					{Name: notFoundFilename, Link: putRaw(t, store, notFound)},
+					{Name: siteManifestFilename, Link: putRaw(t, store, `{"fallback": "app.html"}`)},
+				}
+			},
+			path:       "/missing",
+			wantStatus: http.StatusNotFound,
+			wantBody:   notFound,
+		},
+		{
+			name: "invalid manifest",
+			entries: func(t *testing.T, store objectstore.Store) []dag.Entry {
+				return []dag.Entry{
+					{Name: notFoundFilename, Link: putRaw(t, store, notFound)},
+					{Name: siteManifestFilename, Link: putRaw(t, store, `{"fallback": `)},
+				}
+			},
+			path:       "/missing",
+			wantStatus: http.StatusNotFound,
+			wantBody:   notFound,
+		},
+		{
+			name: "unavailable directory",
+			entries: func(t *testing.T, store objectstore.Store) []dag.Entry {
+				return []dag.Entry{{Name: "gone", Link: absent}}
+			},
+			path:       "/gone/page",
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name: "unavailable file",
+			entries: func(t *testing.T, store objectstore.Store) []dag.Entry {
+				return []dag.Entry{{Name: "gone.txt", Link: absentRaw}}
+			},
+			path:       "/gone.txt",
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name: "unavailable manifest",
+			entries: func(t *testing.T, store objectstore.Store) []dag.Entry {
+				return []dag.Entry{
+					{Name: notFoundFilename, Link: putRaw(t, store, notFound)},
+					{Name: siteManifestFilename, Link: absentRaw},
+				}
+			},
+			path:       "/missing",
+			wantStatus: http.StatusBadGateway,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newTestStore(t)
+			router := newTestRouter(t, hostGateway, false)
+			entries := []dag.Entry{
+				{Name: indexFilename, Link: putRaw(t, store, index)},
+				{Name: "docs", Link: putDir(t, store, dag.Entry{Name: indexFilename, Link: putRaw(t, store, docs)})},
+			}
+			if tc.entries != nil {
+				entries = append(entries, tc.entries(t, store)...)
+			}
+			root := putDir(t, store, entries...)
+
+			w := request(router, http.MethodGet, root, tc.path)
+			if w.Code != tc.wantStatus {
+				t.Fatalf("got status %d, want %d", w.Code, tc.wantStatus)
+			}
+			if tc.wantBody != "" && w.Body.String() != tc.wantBody {
+				t.Errorf("got body %q, want %q", w.Body, tc.wantBody)
+			}
+			if got := w.Header().Get("Location"); got != tc.wantLocation {
+				t.Errorf("got Location %q, want %q", got, tc.wantLocation)
+			}
+			if tc.wantStatus == http.StatusBadGateway {
+				// Failures may be transient, so they must not be cached.
+				for _, h := range []string{"Cache-Control", "ETag"} {
+					if got := w.Header().Get(h); got != "" {
+						t.Errorf("got %s %q, want none", h, got)
+					}
+				}
+			}
+		})
+	}
+}
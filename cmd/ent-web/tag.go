@@ -0,0 +1,119 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/ent/log"
+	"github.com/google/ent/nodeservice"
+	"github.com/google/ent/utils"
+	"github.com/ipfs/go-cid"
+)
+
+const (
+	tagSegment = "tag"
+
+	// Tags may be updated at any time, so responses resolved through them are only cached briefly.
+	tagCacheControl = "public, max-age=60"
+	// Response header with the root that a tag was resolved to.
+	tagTargetHeader = "ent-tag-target"
+)
+
+var (
+	// Public keys of the publishers, by their ID.
+	tagKeys    = map[string]*ecdsa.PublicKey{}
+	tagRemotes []nodeservice.Remote
+
+	// Highest sequence number seen for each tag, by publisher ID and label, so that remotes cannot
+	// roll a tag back to an older version once a newer one has been served.
+	tagSequencesMu sync.Mutex
+	tagSequences   = map[string]uint64{}
+)
+
+func initTags(ctx context.Context, config Config) error {
+	for _, p := range config.Publishers {
+		pk, err := utils.ParsePublicKey(p.PublicKey)
+		if err != nil {
+			return fmt.Errorf("invalid public key for publisher %q: %w", p.Name, err)
+		}
+		id, err := utils.PublicKeyID(pk)
+		if err != nil {
+			return err
+		}
+		log.Infof(ctx, "serving tags of publisher %q at %s", p.Name, id)
+		tagKeys[id] = pk
+	}
+	for _, remote := range config.Remotes {
+		r, err := nodeservice.DialRemote(remote.URL, remote.APIKey, nodeservice.WithCompressor(remote.Compression)...)
+		if err != nil {
+			return fmt.Errorf("could not dial remote %q: %w", remote.Name, err)
+		}
+		tagRemotes = append(tagRemotes, r)
+	}
+	return nil
+}
+
+// resolveTag returns the root that the latest version of the tag with the given label of the
+// publisher with the given ID points to, across all remotes. Versions older than one seen before
+// are rejected.
+func resolveTag(ctx context.Context, id string, label string) (cid.Cid, error) {
+	st, err := nodeservice.LatestTag(ctx, tagRemotes, tagKeys[id], label)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	key := id + "/" + label
+	tagSequencesMu.Lock()
+	defer tagSequencesMu.Unlock()
+	if seen := tagSequences[key]; st.Tag.Sequence < seen {
+		return cid.Cid{}, fmt.Errorf("tag sequence %d is older than %d, which was seen before", st.Tag.Sequence, seen)
+	}
+	tagSequences[key] = st.Tag.Sequence
+	return cid.NewCidV1(utils.TypeDAG, utils.DigestFromProto(st.Tag.Target)), nil
+}
+
+// serveTag serves the DAG pointed to by the tag with the given label of the publisher with the
+// given ID, under base.
+func serveTag(c *gin.Context, id string, label string, base string, path []string) {
+	ctx := c
+	if _, ok := tagKeys[id]; !ok {
+		log.Warningf(ctx, "unknown publisher: %q", id)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	root, err := resolveTag(ctx, id, label)
+	if err == nodeservice.ErrNotFound {
+		log.Debugf(ctx, "tag %q of %s not found", label, id)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Warningf(ctx, "could not resolve tag %q of %s: %s", label, id, err)
+		serveUnavailable(c)
+		return
+	}
+	log.Debugf(ctx, "tag %q of %s: %s", label, id, root)
+	c.Header(tagTargetHeader, root.String())
+	serveSite(c, site{
+		root:         root,
+		base:         base,
+		cacheControl: tagCacheControl,
+	}, path)
+}
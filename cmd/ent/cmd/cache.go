@@ -0,0 +1,114 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/google/ent/cmd/ent/config"
+	"github.com/google/ent/log"
+	"github.com/google/ent/nodeservice"
+	"github.com/google/ent/utils"
+	"github.com/spf13/cobra"
+	"github.com/tonistiigi/units"
+)
+
+var (
+	maxSizeFlag int64
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect and manage the local object cache",
+}
+
+var cacheLsCmd = &cobra.Command{
+	Use:  "ls",
+	Args: cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := mustOpenCache(ctx)
+		entries, err := c.List()
+		if err != nil {
+			log.Criticalf(ctx, "list cache: %v", err)
+			os.Exit(1)
+		}
+		var total int64
+		for _, e := range entries {
+			total += e.Size
+			fmt.Printf("%s %s %.0f\n", color.YellowString(utils.FormatDigest(e.Digest, digestFormatFlag)), e.LastAccess.Format("2006-01-02T15:04:05"), units.Bytes(e.Size))
+		}
+		fmt.Printf("%d objects, %.0f in %s\n", len(entries), units.Bytes(total), c.Dir)
+	},
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:  "prune",
+	Args: cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := mustOpenCache(ctx)
+		maxSize := c.MaxSize
+		if maxSizeFlag >= 0 {
+			maxSize = maxSizeFlag
+		}
+		removed, freed, err := c.Prune(maxSize)
+		if err != nil {
+			log.Criticalf(ctx, "prune cache: %v", err)
+			os.Exit(1)
+		}
+		fmt.Printf("removed %d objects, freed %.0f\n", removed, units.Bytes(freed))
+	},
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:  "clear",
+	Args: cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := mustOpenCache(ctx)
+		removed, freed, err := c.Clear()
+		if err != nil {
+			log.Criticalf(ctx, "clear cache: %v", err)
+			os.Exit(1)
+		}
+		fmt.Printf("removed %d objects, freed %.0f\n", removed, units.Bytes(freed))
+	},
+}
+
+func openCache(c config.Config, inner nodeservice.ObjectGetter) (*nodeservice.Cache, error) {
+	return nodeservice.NewCache(inner, c.Cache.DirName(), c.Cache.MaxSize())
+}
+
+func mustOpenCache(ctx context.Context) *nodeservice.Cache {
+	c, err := openCache(config.ReadConfig(), nil)
+	if err != nil {
+		log.Criticalf(ctx, "open cache: %v", err)
+		os.Exit(1)
+	}
+	return c
+}
+
+func init() {
+	cacheLsCmd.PersistentFlags().StringVar(&digestFormatFlag, "digest-format", "b58", "format [human, hex, b58]")
+	cachePruneCmd.PersistentFlags().Int64Var(&maxSizeFlag, "max-size", -1, "maximum size of the cache in bytes after pruning (defaults to the configured size)")
+	cacheCmd.AddCommand(cacheLsCmd)
+	cacheCmd.AddCommand(cachePruneCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+}
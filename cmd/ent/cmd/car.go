@@ -0,0 +1,115 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/ent/car"
+	"github.com/google/ent/dag"
+	"github.com/google/ent/log"
+	"github.com/google/ent/utils"
+	"github.com/ipfs/go-cid"
+	"github.com/schollz/progressbar/v3"
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export [cid]",
+	Short: "Write a tree and all the objects it links to as a CAR archive to stdout",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		root, err := cid.Decode(args[0])
+		if err != nil {
+			log.Criticalf(ctx, "parse cid %q: %v", args[0], err)
+			os.Exit(1)
+		}
+		out := bufio.NewWriter(os.Stdout)
+		w, err := car.NewWriter(out, []cid.Cid{root})
+		if err != nil {
+			log.Criticalf(ctx, "write CAR header: %v", err)
+			os.Exit(1)
+		}
+		n := 0
+		err = dag.Walk(ctx, GetObjectGetter(), root, func(link cid.Cid, b []byte) error {
+			n++
+			return w.WriteBlock(link, b)
+		})
+		if err != nil {
+			log.Criticalf(ctx, "export: %v", err)
+			os.Exit(1)
+		}
+		if err := out.Flush(); err != nil {
+			log.Criticalf(ctx, "write CAR: %v", err)
+			os.Exit(1)
+		}
+		log.Infof(ctx, "exported %d objects", n)
+	},
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Read a CAR archive from stdin and put all its objects",
+	Args:  cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		r, err := car.NewReader(os.Stdin)
+		if err != nil {
+			log.Criticalf(ctx, "read CAR header: %v", err)
+			os.Exit(1)
+		}
+		p := newPutter(ctx)
+		p.progress = progressbar.DefaultBytes(-1)
+		for {
+			link, b, err := r.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				log.Criticalf(ctx, "read CAR block: %v", err)
+				os.Exit(1)
+			}
+			if !utils.MatchesDigest(b, utils.Digest(link.Hash())) {
+				log.Criticalf(ctx, "digest mismatch for block %s", link)
+				os.Exit(1)
+			}
+			if err := p.put(b, link, link.String()); err != nil {
+				log.Criticalf(ctx, "put block: %v", err)
+				os.Exit(1)
+			}
+		}
+		p.progress.Finish()
+		if err := p.wait(); err != nil {
+			log.Criticalf(ctx, "%v", err)
+			os.Exit(1)
+		}
+		for _, root := range r.Roots {
+			fmt.Printf("root: %s\n", root)
+		}
+	},
+}
+
+func init() {
+	importCmd.PersistentFlags().StringVar(&remoteFlag, "remote", "", "remote")
+	importCmd.PersistentFlags().StringVar(&digestFormatFlag, "digest-format", "b58", "format [human, hex, b58]")
+	importCmd.PersistentFlags().StringVar(&writePolicyFlag, "write-policy", "", "write policy across writable remotes [all, quorum, first] (defaults to the configured policy)")
+	importCmd.PersistentFlags().BoolVar(&strictFlag, "strict", false, "fail if any write fails, even once the write policy is satisfied")
+	importCmd.PersistentFlags().BoolVar(&porcelainFlag, "porcelain", false, "porcelain output (parseable by machines)")
+}
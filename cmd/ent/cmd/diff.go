@@ -0,0 +1,79 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/google/ent/dag"
+	"github.com/google/ent/log"
+	"github.com/ipfs/go-cid"
+	"github.com/spf13/cobra"
+	"github.com/tonistiigi/units"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [cid1] [cid2]",
+	Short: "Show the files that differ between two trees",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		a, err := cid.Decode(args[0])
+		if err != nil {
+			log.Criticalf(ctx, "parse cid %q: %v", args[0], err)
+			os.Exit(1)
+		}
+		b, err := cid.Decode(args[1])
+		if err != nil {
+			log.Criticalf(ctx, "parse cid %q: %v", args[1], err)
+			os.Exit(1)
+		}
+		changes, err := dag.Diff(ctx, GetObjectGetter(), a, b)
+		if err != nil {
+			log.Criticalf(ctx, "diff: %v", err)
+			os.Exit(1)
+		}
+		for _, c := range changes {
+			fmt.Print(formatChange(c))
+		}
+	},
+}
+
+func formatChange(c dag.Change) string {
+	if porcelainFlag {
+		marker := map[dag.ChangeKind]string{
+			dag.Added:    "A",
+			dag.Removed:  "D",
+			dag.Modified: "M",
+		}[c.Kind]
+		return fmt.Sprintf("%s %d %d %s\n", marker, c.OldSize, c.NewSize, c.Path)
+	}
+	switch c.Kind {
+	case dag.Added:
+		return fmt.Sprintf("%s %s %.0f\n", color.GreenString("+"), c.Path, units.Bytes(c.NewSize))
+	case dag.Removed:
+		return fmt.Sprintf("%s %s %.0f\n", color.RedString("-"), c.Path, units.Bytes(c.OldSize))
+	default:
+		return fmt.Sprintf("%s %s %.0f → %.0f\n", color.YellowString("~"), c.Path, units.Bytes(c.OldSize), units.Bytes(c.NewSize))
+	}
+}
+
+func init() {
+	diffCmd.PersistentFlags().BoolVar(&porcelainFlag, "porcelain", false, "porcelain output (parseable by machines)")
+}
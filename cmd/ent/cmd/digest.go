@@ -20,8 +20,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"runtime"
+	"sync"
 
 	"github.com/fatih/color"
+	"github.com/google/ent/dag"
 	"github.com/google/ent/log"
 	"github.com/google/ent/utils"
 	"github.com/ipfs/go-cid"
@@ -30,6 +33,10 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var (
+	jobsFlag int
+)
+
 var digestCmd = &cobra.Command{
 	Use:  "digest [filename]",
 	Args: cobra.MaximumNArgs(1),
@@ -57,6 +64,10 @@ var digestCmd = &cobra.Command{
 
 type traverseF func([]byte, cid.Cid, string) error
 
+// sealF transforms an object before it is passed to traverseF, returning the new object and the
+// link that its parent refers to it by.
+type sealF func([]byte, cid.Cid) ([]byte, cid.Cid, error)
+
 func print(bytes []byte, link cid.Cid, name string) error {
 	fmt.Printf("%s", formatLink(link, name))
 	return nil
@@ -70,74 +81,123 @@ func digestStdin() (utils.Digest, error) {
 	return digestData(data)
 }
 
-func traverseFileOrDir(filename string, f traverseF) (utils.Digest, error) {
+// traverser walks a file or directory tree, invoking f on every file and directory node. Files are
+// read, hashed and passed to f concurrently, with at most cap(tokens) files in flight at any time.
+// Directory nodes are only built once all their children have completed, and links are always
+// stored in directory order, so the resulting digests do not depend on completion order. If seal
+// is set, it is applied to every object before f, and directories link to the sealed objects.
+type traverser struct {
+	f      traverseF
+	seal   sealF
+	tokens chan struct{}
+}
+
+func newTraverser(f traverseF, jobs int) *traverser {
+	if jobs < 1 {
+		jobs = 1
+	}
+	return &traverser{
+		f:      f,
+		tokens: make(chan struct{}, jobs),
+	}
+}
+
+func traverseFileOrDir(filename string, f traverseF) (cid.Cid, error) {
+	return newTraverser(f, jobsFlag).traverseFileOrDir(filename)
+}
+
+func (t *traverser) traverseFileOrDir(filename string) (cid.Cid, error) {
 	info, err := os.Stat(filename)
 	if err != nil {
-		return utils.Digest{}, fmt.Errorf("could not stat %s: %v", filename, err)
+		return cid.Cid{}, fmt.Errorf("could not stat %s: %v", filename, err)
 	}
 	if info.IsDir() {
-		return traverseDir(filename, f)
+		return t.traverseDir(filename)
 	} else {
-		return traverseFile(filename, f)
+		return t.traverseFile(filename)
 	}
 }
 
-func traverseDir(dirname string, f traverseF) (utils.Digest, error) {
+func (t *traverser) traverseDir(dirname string) (cid.Cid, error) {
 	ctx := context.Background()
 	files, err := ioutil.ReadDir(dirname)
 	if err != nil {
-		return utils.Digest{}, fmt.Errorf("could not read directory %s: %v", dirname, err)
+		return cid.Cid{}, fmt.Errorf("could not read directory %s: %v", dirname, err)
 	}
-	links := make([]cid.Cid, 0, len(files))
-	data := ""
-	for _, file := range files {
-		filename := dirname + "/" + file.Name()
-		info, err := os.Stat(filename)
-		if err != nil {
-			return utils.Digest{}, fmt.Errorf("could not stat %q: %v", filename, err)
-		}
-		if info.IsDir() {
-			digest, err := traverseDir(filename, f)
+	links := make([]cid.Cid, len(files))
+	errs := make([]error, len(files))
+	wg := sync.WaitGroup{}
+	for i, file := range files {
+		i, file := i, file
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			filename := dirname + "/" + file.Name()
+			info, err := os.Stat(filename)
 			if err != nil {
-				return utils.Digest{}, err
+				errs[i] = fmt.Errorf("could not stat %q: %v", filename, err)
+				return
 			}
-			links = append(links, cid.NewCidV1(utils.TypeDAG, multihash.Multihash(digest)))
-			data += file.Name() + "\n"
-		} else {
-			digest, err := traverseFile(filename, f)
-			if err != nil {
-				return utils.Digest{}, err
+			if info.IsDir() {
+				links[i], errs[i] = t.traverseDir(filename)
+			} else {
+				links[i], errs[i] = t.traverseFile(filename)
 			}
-			links = append(links, cid.NewCidV1(utils.TypeRaw, multihash.Multihash(digest)))
-			data += file.Name() + "\n"
-		}
+		}()
 	}
-	dagNode := utils.DAGNode{
-		Links: links,
-		Bytes: []byte(data),
+	wg.Wait()
+	entries := make([]dag.Entry, len(files))
+	for i, file := range files {
+		if errs[i] != nil {
+			return cid.Cid{}, errs[i]
+		}
+		entries[i] = dag.Entry{
+			Name: file.Name(),
+			Link: links[i],
+		}
 	}
+	dagNode := dag.NewNode(entries)
 	log.Infof(ctx, "DAG node: %v\n", dagNode)
-	serialized, err := utils.SerializeDAGNode(&dagNode)
+	serialized, err := utils.SerializeDAGNode(dagNode)
 	if err != nil {
-		return utils.Digest{}, err
+		return cid.Cid{}, err
 	}
 	digest := utils.ComputeDigest(serialized)
 	link := cid.NewCidV1(utils.TypeDAG, multihash.Multihash(digest))
-	err = f(serialized, link, dirname+"/")
+	link, err = t.visit(serialized, link, dirname+"/")
 	if err != nil {
-		log.Infof(ctx, "could not traverse directory %q: %v", dirname, err)
+		return cid.Cid{}, fmt.Errorf("could not traverse directory %q: %w", dirname, err)
 	}
-	return digest, nil
+	return link, nil
 }
 
-func traverseFile(filename string, f traverseF) (utils.Digest, error) {
+func (t *traverser) traverseFile(filename string) (cid.Cid, error) {
+	// Tokens are only held while processing a single file, never while waiting for children, so
+	// that a deep tree cannot exhaust all tokens and deadlock.
+	t.tokens <- struct{}{}
+	defer func() { <-t.tokens }()
 	data, err := os.ReadFile(filename)
 	if err != nil {
-		return utils.Digest{}, fmt.Errorf("could not read file %q: %v", filename, err)
+		return cid.Cid{}, fmt.Errorf("could not read file %q: %v", filename, err)
 	}
-	link := cid.NewCidV1(utils.TypeRaw, multihash.Multihash(utils.ComputeDigest(data)))
-	f(data, link, filename)
-	return digestData(data)
+	digest := utils.ComputeDigest(data)
+	link := cid.NewCidV1(utils.TypeRaw, multihash.Multihash(digest))
+	return t.visit(data, link, filename)
+}
+
+// visit seals the object, if needed, and passes it to f, returning the link to it.
+func (t *traverser) visit(b []byte, link cid.Cid, name string) (cid.Cid, error) {
+	if t.seal != nil {
+		var err error
+		b, link, err = t.seal(b, link)
+		if err != nil {
+			return cid.Cid{}, fmt.Errorf("could not seal %q: %w", name, err)
+		}
+	}
+	if err := t.f(b, link, name); err != nil {
+		return cid.Cid{}, err
+	}
+	return link, nil
 }
 
 func digestData(data []byte) (utils.Digest, error) {
@@ -157,3 +217,7 @@ func formatLink(link cid.Cid, name string) string {
 	}
 	return fmt.Sprintf("%s %s\n", color.YellowString(linkString), name)
 }
+
+func init() {
+	digestCmd.PersistentFlags().IntVar(&jobsFlag, "jobs", runtime.NumCPU(), "number of files to process concurrently")
+}
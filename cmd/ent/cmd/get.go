@@ -23,11 +23,17 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/google/ent/api"
 	"github.com/google/ent/cmd/ent/config"
+	"github.com/google/ent/dag"
+	"github.com/google/ent/encryption"
 	"github.com/google/ent/log"
+	"github.com/google/ent/nodeservice"
 	"github.com/google/ent/utils"
+	"github.com/ipfs/go-cid"
 	"github.com/spf13/cobra"
 )
 
@@ -42,16 +48,46 @@ var getCmd = &cobra.Command{
 	Args: cobra.ExactArgs(0),
 	Run: func(cmd *cobra.Command, args []string) {
 		ctx := context.Background()
+		if link, err := cid.Decode(digestFlag); err == nil && encryption.IsLink(link) {
+			if err := getEncrypted(ctx, link); err != nil {
+				log.Criticalf(ctx, "%v", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
 		digest, err := utils.ParseDigest(digestFlag)
 		if err != nil {
 			log.Criticalf(ctx, "parse digest: %v", err)
 			os.Exit(1)
 		}
+		var cache *nodeservice.Cache
+		if c := config.ReadConfig(); c.Cache.Enabled {
+			cache, err = openCache(c, nil)
+			if err != nil {
+				log.Errorf(ctx, "could not open cache: %v", err)
+			}
+		}
+		if cache != nil {
+			body, err := cache.Get(ctx, digest)
+			if err == nil {
+				log.Debugf(ctx, "found in cache")
+				fmt.Printf("size: %v\n", len(body))
+				if outFlag != "" {
+					os.WriteFile(outFlag, body, 0644)
+				}
+				os.Exit(0)
+			}
+		}
 		// Make API request to get entry metadata and mirrors
 		resp, err := getEntry(ctx, digest)
 		if err != nil {
-			log.Criticalf(ctx, "get entry request failed: %v", err)
-			os.Exit(1)
+			log.Warningf(ctx, "get entry request failed, falling back to remotes: %v", err)
+			err := getFromRemotes(ctx, digest)
+			if err != nil {
+				log.Criticalf(ctx, "%v", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
 		}
 		log.Debugf(ctx, "got entry response: metadata=%+v mirrors=%+v", resp.Metadata, resp.Mirrors)
 		fmt.Printf("size: %v\n", resp.Metadata.LengthBytes)
@@ -79,6 +115,12 @@ var getCmd = &cobra.Command{
 			}
 			log.Debugf(ctx, "digest matches")
 
+			if cache != nil {
+				if err := cache.Add(ctx, digest, body); err != nil {
+					log.Warningf(ctx, "could not add object to cache: %v", err)
+				}
+			}
+
 			if outFlag != "" {
 				os.WriteFile(outFlag, body, 0644)
 			}
@@ -89,53 +131,146 @@ var getCmd = &cobra.Command{
 	},
 }
 
+// getFromRemotes fetches the object from the configured remotes, printing its metadata before
+// downloading it.
+func getFromRemotes(ctx context.Context, digest utils.Digest) error {
+	o := getMultiplexObjectGetter(config.ReadConfig())
+	m, err := o.GetMetadata(ctx, digest)
+	if err != nil {
+		return fmt.Errorf("get metadata: %w", err)
+	}
+	fmt.Printf("size: %v\n", m.Size)
+	if m.MediaType != "" {
+		fmt.Printf("media type: %v\n", m.MediaType)
+	}
+	if !m.CreationTime.IsZero() {
+		fmt.Printf("created: %v\n", m.CreationTime)
+	}
+	body, err := o.Get(ctx, digest)
+	if err != nil {
+		return fmt.Errorf("get object: %w", err)
+	}
+	if outFlag != "" {
+		return os.WriteFile(outFlag, body, 0644)
+	}
+	return nil
+}
+
+// getEncrypted fetches and decrypts the object referred to by a link printed by `ent put --encrypt`.
+// Trees are written to the directory specified by --out.
+func getEncrypted(ctx context.Context, link cid.Cid) error {
+	r, err := encryption.ParseLink(link)
+	if err != nil {
+		return err
+	}
+	o := getMultiplexObjectGetter(config.ReadConfig())
+	if r.Type == utils.TypeDAG {
+		if outFlag == "" {
+			return fmt.Errorf("--out is required to get a tree")
+		}
+		return getEncryptedTree(ctx, o, link, outFlag)
+	}
+	body, err := encryption.Get(ctx, o, link)
+	if err != nil {
+		return fmt.Errorf("get object: %w", err)
+	}
+	fmt.Printf("size: %v\n", len(body))
+	if outFlag != "" {
+		return os.WriteFile(outFlag, body, 0644)
+	}
+	return nil
+}
+
+func getEncryptedTree(ctx context.Context, o nodeservice.ObjectGetter, link cid.Cid, dirname string) error {
+	b, err := encryption.Get(ctx, o, link)
+	if err != nil {
+		return fmt.Errorf("get directory %q: %w", dirname, err)
+	}
+	node, err := utils.ParseDAGNode(b)
+	if err != nil {
+		return fmt.Errorf("parse directory %q: %w", dirname, err)
+	}
+	if err := os.MkdirAll(dirname, 0755); err != nil {
+		return err
+	}
+	for _, e := range dag.Entries(node) {
+		if e.Name == "" || e.Name == "." || e.Name == ".." || strings.ContainsAny(e.Name, "/\\") {
+			return fmt.Errorf("invalid name in directory %q: %q", dirname, e.Name)
+		}
+		filename := filepath.Join(dirname, e.Name)
+		switch e.Link.Type() {
+		case utils.TypeEncryptedDAG:
+			if err := getEncryptedTree(ctx, o, e.Link, filename); err != nil {
+				return err
+			}
+		case utils.TypeEncryptedRaw:
+			body, err := encryption.Get(ctx, o, e.Link)
+			if err != nil {
+				return fmt.Errorf("get file %q: %w", filename, err)
+			}
+			if err := os.WriteFile(filename, body, 0644); err != nil {
+				return err
+			}
+			fmt.Printf("%s\n", filename)
+		default:
+			return fmt.Errorf("unexpected link type in encrypted directory %q: %v", dirname, e.Link.Type())
+		}
+	}
+	return nil
+}
+
 func getEntry(ctx context.Context, digest utils.Digest) (*api.GetEntryResponse, error) {
 	req := api.GetEntryRequest{
 		Digests: utils.DigestToApi(digest),
 	}
-	log.Debugf(ctx, "sending request: %v", req)
 	var resp api.GetEntryResponse
-	config := config.ReadConfig()
+	r := config.ReadConfig().Remotes[0]
+	err := callAPI(ctx, r.URL, r.APIKey, api.GET_ENTRY_METHOD_ID, req, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// callAPI invokes a method of the JSON API exposed at baseURL, decoding the response into resp. The
+// API key, if not empty, is sent along with the request.
+func callAPI(ctx context.Context, baseURL string, apiKey string, method string, req interface{}, resp interface{}) error {
+	log.Debugf(ctx, "sending request: %v", req)
 	client := &http.Client{}
 	jsonData, err := json.Marshal(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	httpReq, err := http.NewRequestWithContext(
 		ctx,
 		http.MethodPost,
-		config.Remotes[0].URL+"/"+api.GET_ENTRY_METHOD_ID,
+		baseURL+"/"+method,
 		bytes.NewBuffer(jsonData),
 	)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		httpReq.Header.Set(nodeservice.APIKeyHeader, apiKey)
+	}
 
 	httpResp, err := client.Do(httpReq)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer httpResp.Body.Close()
 
 	if httpResp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server returned status %v", httpResp.Status)
-	}
-
-	err = json.NewDecoder(httpResp.Body).Decode(&resp)
-	if err != nil {
-		return nil, err
+		return fmt.Errorf("server returned status %v", httpResp.Status)
 	}
 
-	return &api.GetEntryResponse{
-		Metadata: resp.Metadata,
-		Mirrors:  resp.Mirrors,
-	}, nil
+	return json.NewDecoder(httpResp.Body).Decode(resp)
 }
 
 func init() {
-	getCmd.PersistentFlags().StringVar(&digestFlag, "digest", "", "digest of the object to fetch")
+	getCmd.PersistentFlags().StringVar(&digestFlag, "digest", "", "digest of the object to fetch, or link printed by put --encrypt")
 	getCmd.PersistentFlags().StringVar(&urlFlag, "url", "", "optional URL of the object to fetch")
 	getCmd.PersistentFlags().StringVar(&outFlag, "out", "", "optional output file")
 }
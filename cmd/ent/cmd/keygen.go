@@ -25,6 +25,7 @@ import (
 	"os"
 
 	"github.com/google/ent/log"
+	"github.com/google/ent/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -53,6 +54,13 @@ var keygenCmd = &cobra.Command{
 		pks := base64.URLEncoding.EncodeToString(pk)
 		log.Infof(ctx, "Public key: %q", pks)
 
+		id, err := utils.PublicKeyID(&k.PublicKey)
+		if err != nil {
+			log.Criticalf(ctx, "compute public key ID: %v", err)
+			os.Exit(1)
+		}
+		log.Infof(ctx, "Public key ID: %q", id)
+
 		text := "hello world"
 		sig, err := ecdsa.SignASN1(rand.Reader, k, []byte(text))
 		if err != nil {
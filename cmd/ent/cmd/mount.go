@@ -0,0 +1,60 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"github.com/google/ent/log"
+	"github.com/google/ent/utils"
+	"github.com/ipfs/go-cid"
+	"github.com/spf13/cobra"
+)
+
+var maxFileSizeFlag uint64
+
+var mountCmd = &cobra.Command{
+	Use:   "mount [cid] [mountpoint]",
+	Short: "Mount a tree as a read-only FUSE filesystem",
+	Long: `Mount a tree as a read-only FUSE filesystem (Linux and macOS only).
+
+Directories are fetched as they are listed. Files are fetched in full, and verified against their
+digest, when they are opened, and their contents are kept in memory until they are closed, so files
+larger than --max-file-size cannot be opened.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		root, err := cid.Decode(args[0])
+		if err != nil {
+			log.Criticalf(ctx, "parse cid %q: %v", args[0], err)
+			os.Exit(1)
+		}
+		if root.Type() != utils.TypeDAG {
+			log.Criticalf(ctx, "cid %q is not a directory", args[0])
+			os.Exit(1)
+		}
+		err = mount(ctx, root, args[1])
+		if err != nil {
+			log.Criticalf(ctx, "mount: %v", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	mountCmd.PersistentFlags().Uint64Var(&maxFileSizeFlag, "max-file-size", 1<<30, "size in bytes of the largest file that may be opened")
+}
@@ -0,0 +1,210 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || darwin
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/google/ent/dag"
+	"github.com/google/ent/log"
+	"github.com/google/ent/nodeservice"
+	"github.com/google/ent/utils"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/ipfs/go-cid"
+)
+
+// mount serves the tree rooted at root at mountpoint, until the process is interrupted.
+func mount(ctx context.Context, root cid.Cid, mountpoint string) error {
+	server, err := fs.Mount(mountpoint, &dirNode{og: GetObjectGetter(), link: root}, &fs.Options{
+		MountOptions: fuse.MountOptions{
+			FsName: root.String(),
+			Name:   "ent",
+			Options: []string{
+				"ro",
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	log.Infof(ctx, "mounted %s at %q", root, mountpoint)
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		if err := server.Unmount(); err != nil {
+			log.Errorf(ctx, "unmount: %v", err)
+		}
+	}()
+	server.Wait()
+	return nil
+}
+
+// dirNode exposes a directory node of the tree. Its entries are fetched the first time they are
+// needed.
+type dirNode struct {
+	fs.Inode
+	og   nodeservice.ObjectGetter
+	link cid.Cid
+}
+
+var _ = (fs.NodeLookuper)((*dirNode)(nil))
+var _ = (fs.NodeReaddirer)((*dirNode)(nil))
+var _ = (fs.NodeGetattrer)((*dirNode)(nil))
+
+func (n *dirNode) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Mode = fuse.S_IFDIR | 0555
+	return 0
+}
+
+func (n *dirNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	link, err := dag.ResolvePath(ctx, n.og, n.link, []string{name})
+	if err != nil {
+		log.Debugf(ctx, "lookup %q: %v", name, err)
+		return nil, syscall.ENOENT
+	}
+	if link.Type() == utils.TypeDAG {
+		out.Mode = fuse.S_IFDIR | 0555
+		return n.NewInode(ctx, &dirNode{og: n.og, link: link}, fs.StableAttr{Mode: fuse.S_IFDIR}), 0
+	}
+	child := &fileNode{og: n.og, link: link}
+	if errno := child.loadSize(ctx); errno != 0 {
+		return nil, errno
+	}
+	out.Mode = fuse.S_IFREG | 0444
+	out.Size = child.size
+	return n.NewInode(ctx, child, fs.StableAttr{Mode: fuse.S_IFREG}), 0
+}
+
+func (n *dirNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	entries, err := dag.GetEntries(ctx, n.og, n.link)
+	if err != nil {
+		log.Errorf(ctx, "readdir %s: %v", n.link, err)
+		return nil, syscall.EIO
+	}
+	list := make([]fuse.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		mode := uint32(fuse.S_IFREG)
+		if e.Link.Type() == utils.TypeDAG {
+			mode = fuse.S_IFDIR
+		}
+		list = append(list, fuse.DirEntry{
+			Name: e.Name,
+			Mode: mode,
+		})
+	}
+	return fs.NewListDirStream(list), 0
+}
+
+// fileNode exposes a raw object of the tree. Its size is obtained from the object metadata, without
+// fetching it; the contents are only fetched (and verified) in full when the file is opened, and are
+// held by the file handle until it is released. Reads are not served against the remote directly,
+// since a partial object cannot be verified against its digest, so files larger than
+// maxFileSizeFlag are refused.
+type fileNode struct {
+	fs.Inode
+	og   nodeservice.ObjectGetter
+	link cid.Cid
+
+	mu    sync.Mutex
+	size  uint64
+	sized bool
+}
+
+var _ = (fs.NodeOpener)((*fileNode)(nil))
+var _ = (fs.NodeGetattrer)((*fileNode)(nil))
+
+func (n *fileNode) loadSize(ctx context.Context) syscall.Errno {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.sized {
+		return 0
+	}
+	m, err := n.og.GetMetadata(ctx, utils.Digest(n.link.Hash()))
+	if err != nil {
+		log.Errorf(ctx, "could not get metadata of blob %s: %v", n.link, err)
+		return syscall.EIO
+	}
+	n.size = m.Size
+	n.sized = true
+	return 0
+}
+
+func (n *fileNode) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	if errno := n.loadSize(ctx); errno != 0 {
+		return errno
+	}
+	out.Mode = fuse.S_IFREG | 0444
+	out.Size = n.size
+	return 0
+}
+
+func (n *fileNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	if errno := n.loadSize(ctx); errno != 0 {
+		return nil, 0, errno
+	}
+	if n.size > maxFileSizeFlag {
+		log.Warningf(ctx, "not opening %s: size %d exceeds --max-file-size", n.link, n.size)
+		return nil, 0, syscall.EFBIG
+	}
+	b, err := n.og.Get(ctx, utils.Digest(n.link.Hash()))
+	if err != nil {
+		log.Errorf(ctx, "could not get blob %s: %v", n.link, err)
+		return nil, 0, syscall.EIO
+	}
+	// Contents are immutable, so the kernel can keep them cached across opens.
+	return &fileHandle{data: b}, fuse.FOPEN_KEEP_CACHE, 0
+}
+
+// fileHandle serves reads at arbitrary offsets from the contents of an open file.
+type fileHandle struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+var _ = (fs.FileReader)((*fileHandle)(nil))
+var _ = (fs.FileReleaser)((*fileHandle)(nil))
+
+func (h *fileHandle) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if off >= int64(len(h.data)) {
+		return fuse.ReadResultData(nil), 0
+	}
+	end := off + int64(len(dest))
+	if end > int64(len(h.data)) {
+		end = int64(len(h.data))
+	}
+	return fuse.ReadResultData(h.data[off:end]), 0
+}
+
+func (h *fileHandle) Release(ctx context.Context) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.data = nil
+	return 0
+}
@@ -16,28 +16,38 @@
 package cmd
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 
 	"github.com/fatih/color"
 	"github.com/google/ent/cmd/ent/config"
 	"github.com/google/ent/cmd/ent/remote"
+	"github.com/google/ent/encryption"
 	"github.com/google/ent/log"
 	"github.com/google/ent/nodeservice"
 	"github.com/google/ent/utils"
 	"github.com/ipfs/go-cid"
 	"github.com/multiformats/go-multihash"
+	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
 	"github.com/tonistiigi/units"
 )
 
 var (
-	remoteFlag       string
-	digestFormatFlag string
-	porcelainFlag    bool
+	remoteFlag         string
+	digestFormatFlag   string
+	porcelainFlag      bool
+	tarFlag            bool
+	writePolicyFlag    string
+	encryptFlag        bool
+	encryptionModeFlag string
+	strictFlag         bool
 )
 
 var putCmd = &cobra.Command{
@@ -49,96 +59,298 @@ var putCmd = &cobra.Command{
 			filename = args[0]
 		}
 		ctx := context.Background()
+		p := newPutter(ctx)
+		if tarFlag {
+			err := p.putTarFile(filename)
+			if err != nil {
+				log.Criticalf(ctx, "could not put tar archive: %v", err)
+				os.Exit(1)
+			}
+			if err := p.wait(); err != nil {
+				log.Criticalf(ctx, "%v", err)
+				os.Exit(1)
+			}
+			return
+		}
 		if filename == "" {
-			err := putStdin()
+			err := p.putStdin()
 			if err != nil {
 				log.Criticalf(ctx, "could not read from stdin: %v", err)
 				os.Exit(1)
 			}
 		} else {
-			_, err := traverseFileOrDir(filename, put)
+			size, err := totalSize(filename)
+			if err != nil {
+				log.Criticalf(ctx, "could not compute total size: %v", err)
+				os.Exit(1)
+			}
+			p.progress = progressbar.DefaultBytes(size)
+			t := newTraverser(p.put, jobsFlag)
+			t.seal = p.seal
+			root, err := t.traverseFileOrDir(filename)
 			if err != nil {
 				log.Criticalf(ctx, "could not traverse file: %v", err)
 				os.Exit(1)
 			}
+			p.progress.Finish()
+			p.printRoot(root, filename)
+		}
+		if err := p.wait(); err != nil {
+			log.Criticalf(ctx, "%v", err)
+			os.Exit(1)
 		}
-
 	},
 }
 
-func putStdin() error {
+func newPutter(ctx context.Context) *putter {
+	c := config.ReadConfig()
+	policy := c.WritePolicy
+	if writePolicyFlag != "" {
+		policy = writePolicyFlag
+	}
+	writePolicy, err := nodeservice.ParseWritePolicy(policy)
+	if err != nil {
+		log.Criticalf(ctx, "could not use write policy: %v", err)
+		os.Exit(1)
+	}
+	inner := []nodeservice.Inner{}
+	for _, r := range writeRemotes(ctx, c) {
+		store := remote.GetObjectStore(r)
+		if store == nil {
+			log.Criticalf(ctx, "remote %q is not writable", r.Name)
+			os.Exit(1)
+		}
+		inner = append(inner, nodeservice.Inner{
+			Name:         r.Name,
+			ObjectGetter: *store,
+			Write:        true,
+		})
+	}
+	p := &putter{
+		nodeService: nodeservice.Sequence{
+			Inner:       inner,
+			WritePolicy: writePolicy,
+			Background:  &sync.WaitGroup{},
+		},
+	}
+	p.nodeService.OnBackgroundResult = p.backgroundResult
+	if encryptFlag {
+		mode, err := encryption.ParseMode(encryptionModeFlag)
+		if err != nil {
+			log.Criticalf(ctx, "could not use encryption mode: %v", err)
+			os.Exit(1)
+		}
+		p.encrypt = &encryption.Store{
+			Inner: p.nodeService,
+			Mode:  mode,
+		}
+		if mode == encryption.Convergent {
+			k, err := utils.ParseSecretKey(c.SecretKey)
+			if err != nil {
+				log.Criticalf(ctx, "convergent encryption requires a valid secret_key in the config: %v", err)
+				os.Exit(1)
+			}
+			p.encrypt.Secret, err = encryption.SecretFromKey(k)
+			if err != nil {
+				log.Criticalf(ctx, "could not use secret_key for convergent encryption: %v", err)
+				os.Exit(1)
+			}
+		}
+	}
+	return p
+}
+
+// writeRemotes returns the remote selected with the --remote flag, or otherwise all the writable
+// remotes in the config, and exits if there are none.
+func writeRemotes(ctx context.Context, c config.Config) []config.Remote {
+	if remoteFlag != "" {
+		r, err := remote.GetRemote(c, remoteFlag)
+		if err != nil {
+			log.Criticalf(ctx, "could not use remote: %v", err)
+			os.Exit(1)
+		}
+		return []config.Remote{r}
+	}
+	remotes := []config.Remote{}
+	for _, r := range c.Remotes {
+		if r.Write {
+			remotes = append(remotes, r)
+		}
+	}
+	if len(remotes) == 0 {
+		log.Criticalf(ctx, "no writable remotes configured")
+		os.Exit(1)
+	}
+	return remotes
+}
+
+// putter uploads the objects produced by a traversal to all the writable remotes, according to the
+// configured write policy. Its put method is safe to call concurrently, and reports progress on a
+// single bar aggregated across all objects. If encrypt is set, objects are encrypted before being
+// uploaded.
+type putter struct {
+	nodeService nodeservice.Sequence
+	progress    *progressbar.ProgressBar
+	encrypt     *encryption.Store
+
+	mu     sync.Mutex
+	failed int
+}
+
+// wait blocks until all the writes that were left running in the background have completed. These
+// only start once the write policy is satisfied, so their failures are logged but not returned,
+// unless --strict is set.
+func (p *putter) wait() error {
+	p.nodeService.Background.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failed == 0 {
+		return nil
+	}
+	if strictFlag {
+		return fmt.Errorf("%d background writes failed", p.failed)
+	}
+	log.Warningf(context.Background(), "%d background writes failed after the write policy was satisfied", p.failed)
+	return nil
+}
+
+// backgroundResult reports the final result of a write that completed in the background.
+func (p *putter) backgroundResult(digest utils.Digest, r nodeservice.PutResult) {
+	if r.Err != nil {
+		log.Errorf(context.Background(), "could not put object %s to remote %q: %v", utils.DigestForLog(digest), r.Name, r.Err)
+		p.mu.Lock()
+		p.failed++
+		p.mu.Unlock()
+	}
+	if !porcelainFlag {
+		digestString := utils.FormatDigest(digest, digestFormatFlag)
+		fmt.Printf("%s [%s]\n", color.YellowString(digestString), formatPutResults([]nodeservice.PutResult{r}))
+	}
+}
+
+func (p *putter) putStdin() error {
 	data, err := ioutil.ReadAll(os.Stdin)
 	if err != nil {
 		return fmt.Errorf("could not read stdin: %v", err)
 	}
+	p.progress = progressbar.DefaultBytes(int64(len(data)))
+	defer p.progress.Finish()
 	digest := utils.ComputeDigest(data)
 	link := cid.NewCidV1(utils.TypeRaw, multihash.Multihash(digest))
-	return put(data, link, "-")
+	data, link, err = p.seal(data, link)
+	if err != nil {
+		return err
+	}
+	if err := p.put(data, link, "-"); err != nil {
+		return err
+	}
+	p.printRoot(link, "-")
+	return nil
 }
 
-// func putFile(filename string) error {
-// 	data, err := os.ReadFile(filename)
-// 	if err != nil {
-// 		return fmt.Errorf("could not read file %q: %v", filename, err)
-// 	}
-// 	return putData(data)
-// }
+// seal encrypts the object if encryption is enabled, returning the bytes to upload and the link to
+// refer to them by.
+func (p *putter) seal(b []byte, link cid.Cid) ([]byte, cid.Cid, error) {
+	if p.encrypt == nil {
+		return b, link, nil
+	}
+	return p.encrypt.Seal(b, link.Type())
+}
 
-func put(b []byte, link cid.Cid, name string) error {
+// printRoot prints the link to the root of an encrypted tree, which embeds the keys needed to get it
+// back. It is the last line printed by put.
+func (p *putter) printRoot(link cid.Cid, name string) {
+	if p.encrypt == nil {
+		return
+	}
+	if porcelainFlag {
+		fmt.Printf("%s\n", link)
+	} else {
+		fmt.Printf("%s", formatLink(link, name))
+	}
+}
+
+func (p *putter) put(b []byte, link cid.Cid, name string) error {
 	ctx := context.Background()
-	config := config.ReadConfig()
-	r := config.Remotes[0]
-	if remoteFlag != "" {
-		var err error
-		r, err = remote.GetRemote(config, remoteFlag)
+	size := len(b)
+
+	digest := utils.Digest(link.Hash())
+	switch link.Type() {
+	case utils.TypeRaw, utils.TypeDAG:
+	case utils.TypeEncryptedRaw, utils.TypeEncryptedDAG:
+		r, err := encryption.ParseLink(link)
 		if err != nil {
-			return fmt.Errorf("could not use remote: %v", err)
+			return err
 		}
+		digest = r.Digest
+	default:
+		return fmt.Errorf("unknown type: %v", link.Type())
 	}
-	nodeService := remote.GetObjectStore(r)
-	size := len(b)
 
+	digestString := utils.FormatDigest(digest, digestFormatFlag)
+	log.Infof(ctx, "putting object %q", digestString)
+	_, results, err := p.nodeService.PutAll(ctx, b)
+	// Only raw objects count towards progress, since the total is computed from file sizes.
 	switch link.Type() {
 	case utils.TypeRaw:
-		digest := utils.Digest(link.Hash())
-		digestString := utils.FormatDigest(digest, digestFormatFlag)
+		p.progress.Add(size)
+	case utils.TypeEncryptedRaw:
+		p.progress.Add(size - encryption.Overhead)
+	}
+	if porcelainFlag {
+		fmt.Printf("%s\n", digestString)
+	} else {
+		fmt.Printf("%s [%s] %s %.0f\n", color.YellowString(digestString), formatPutResults(results), name, units.Bytes(size))
+	}
+	if err != nil {
+		log.Errorf(ctx, "could not put object: %v", err)
+		return fmt.Errorf("could not put object: %v", err)
+	}
+	return nil
+}
+
+func formatPutResults(results []nodeservice.PutResult) string {
+	out := []string{}
+	for _, r := range results {
 		marker := color.GreenString("-")
-		if exists(nodeService, digest) {
+		switch r.Status {
+		case nodeservice.PutExisted:
 			marker = color.GreenString("✓")
-		} else {
-			log.Infof(ctx, "putting object %q", digestString)
-			_, err := nodeService.Put(ctx, uint64(size), bytes.NewReader(b))
-			if err != nil {
-				log.Errorf(ctx, "could not put object: %v", err)
-				return fmt.Errorf("could not put object: %v", err)
-			}
+		case nodeservice.PutUploaded:
 			marker = color.BlueString("↑")
+		case nodeservice.PutFailed:
+			marker = color.RedString("✗")
+		case nodeservice.PutPending:
+			marker = color.YellowString("…")
 		}
-		if porcelainFlag {
-			fmt.Printf("%s\n", digestString)
-		} else {
-			fmt.Printf("%s [%s %s] %s %.0f\n", color.YellowString(digestString), marker, r.Name, name, units.Bytes(size))
-		}
-		return nil
-	case utils.TypeDAG:
-		return nil
-	default:
-		return fmt.Errorf("unknown type: %v", link.Type())
+		out = append(out, marker+" "+r.Name)
 	}
+	return strings.Join(out, " ")
 }
 
-func exists(nodeService nodeservice.ObjectGetter, digest utils.Digest) bool {
-	ctx := context.Background()
-	ok, err := nodeService.Has(ctx, digest)
-	if err != nil {
-		log.Errorf(ctx, "could not check existence of %q: %v", digest, err)
-		return false
-	}
-	return ok
+// totalSize returns the total size in bytes of the regular files under filename.
+func totalSize(filename string) (int64, error) {
+	var size int64
+	err := filepath.Walk(filename, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
 }
 
 func init() {
 	putCmd.PersistentFlags().StringVar(&remoteFlag, "remote", "", "remote")
 	putCmd.PersistentFlags().StringVar(&digestFormatFlag, "digest-format", "b58", "format [human, hex, b58]")
 	putCmd.PersistentFlags().BoolVar(&porcelainFlag, "porcelain", false, "porcelain output (parseable by machines)")
+	putCmd.PersistentFlags().BoolVar(&tarFlag, "tar", false, "read the input as a tar archive, and put its contents as a tree")
+	putCmd.PersistentFlags().StringVar(&writePolicyFlag, "write-policy", "", "write policy across writable remotes [all, quorum, first] (defaults to the configured policy)")
+	putCmd.PersistentFlags().BoolVar(&encryptFlag, "encrypt", false, "encrypt objects before uploading them, and print the link to the root, which embeds the keys to decrypt it")
+	putCmd.PersistentFlags().StringVar(&encryptionModeFlag, "encryption-mode", "convergent", "encryption mode [convergent, random]")
+	putCmd.PersistentFlags().BoolVar(&strictFlag, "strict", false, "fail if any write fails, even once the write policy is satisfied")
+	putCmd.PersistentFlags().IntVar(&jobsFlag, "jobs", runtime.NumCPU(), "number of files to process concurrently")
 }
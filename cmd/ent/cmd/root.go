@@ -17,37 +17,86 @@ package cmd
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"fmt"
 	"os"
 
 	"github.com/google/ent/cmd/ent/config"
 	"github.com/google/ent/log"
 	"github.com/google/ent/nodeservice"
+	"github.com/google/ent/utils"
 	"github.com/spf13/cobra"
 )
 
 func getMultiplexObjectGetter(c config.Config) nodeservice.ObjectGetter {
 	inner := make([]nodeservice.Inner, 0)
 	for _, remote := range c.Remotes {
+		o, err := getObjectGetter(c, remote)
+		if err != nil {
+			log.Errorf(context.Background(), "skipping remote %q: %v", remote.Name, err)
+			continue
+		}
 		inner = append(inner, nodeservice.Inner{
 			Name:         remote.Name,
-			ObjectGetter: getObjectGetter(remote)})
+			ObjectGetter: o,
+			Write:        remote.Write,
+		})
+	}
+	mode, err := nodeservice.ParseFetchMode(c.Fetch.Mode)
+	if err != nil {
+		log.Errorf(context.Background(), "could not parse fetch mode: %v", err)
+	}
+	var stats *nodeservice.Stats
+	if c.Fetch.Adaptive {
+		stats = nodeservice.NewStats()
 	}
-	return nodeservice.Sequence{
-		Inner: inner,
+	var o nodeservice.ObjectGetter = nodeservice.Sequence{
+		Inner:      inner,
+		Mode:       mode,
+		HedgeDelay: c.Fetch.HedgeDelay,
+		Stats:      stats,
+	}
+	if c.Cache.Enabled {
+		cache, err := openCache(c, o)
+		if err != nil {
+			log.Errorf(context.Background(), "could not open cache: %v", err)
+			return o
+		}
+		return cache
 	}
+	return o
 }
 
-func getObjectGetter(remote config.Remote) nodeservice.ObjectGetter {
+func getObjectGetter(c config.Config, remote config.Remote) (nodeservice.ObjectGetter, error) {
 	if remote.Index {
 		return nodeservice.IndexClient{
-			BaseURL: remote.URL,
-		}
+			BaseURL:          remote.URL,
+			Race:             c.Fetch.RaceMirrors,
+			TrustedKeys:      trustedKeys(c),
+			RequireSignature: remote.RequireSignature,
+			Packed:           remote.Packed,
+			Manifests:        nodeservice.NewManifestCache(0),
+		}, nil
 	} else {
-		return nodeservice.Remote{
-			APIURL: remote.URL,
-			APIKey: remote.APIKey,
+		r, err := nodeservice.DialRemote(remote.URL, remote.APIKey, nodeservice.WithCompressor(remote.Compression)...)
+		if err != nil {
+			return nil, fmt.Errorf("could not dial remote %q: %w", remote.Name, err)
+		}
+		return r, nil
+	}
+}
+
+func trustedKeys(c config.Config) []*ecdsa.PublicKey {
+	keys := []*ecdsa.PublicKey{}
+	for _, t := range c.TrustedIndexers {
+		pk, err := utils.ParsePublicKey(t.PublicKey)
+		if err != nil {
+			log.Errorf(context.Background(), "invalid public key for trusted indexer %q: %v", t.Name, err)
+			continue
 		}
+		keys = append(keys, pk)
 	}
+	return keys
 }
 
 var rootCmd = &cobra.Command{
@@ -67,6 +116,14 @@ func init() {
 	rootCmd.AddCommand(getCmd)
 	rootCmd.AddCommand(putCmd)
 	rootCmd.AddCommand(keygenCmd)
+	rootCmd.AddCommand(cacheCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(mountCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(importCmd)
+	rootCmd.AddCommand(syncCmd)
+	rootCmd.AddCommand(snapshotCmd)
+	rootCmd.AddCommand(tagCmd)
 }
 
 func GetObjectGetter() nodeservice.ObjectGetter {
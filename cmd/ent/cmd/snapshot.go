@@ -0,0 +1,81 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/google/ent/api"
+	"github.com/google/ent/cmd/ent/config"
+	"github.com/google/ent/cmd/ent/remote"
+	"github.com/google/ent/log"
+	"github.com/spf13/cobra"
+)
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot [url]",
+	Short: "Ask a remote to fetch and keep a copy of the object at the given URL, and print its digests",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := config.ReadConfig()
+		if len(c.Remotes) == 0 {
+			log.Criticalf(ctx, "no remotes configured")
+			os.Exit(1)
+		}
+		r := c.Remotes[0]
+		if remoteFlag != "" {
+			var err error
+			r, err = remote.GetRemote(c, remoteFlag)
+			if err != nil {
+				log.Criticalf(ctx, "could not use remote: %v", err)
+				os.Exit(1)
+			}
+		}
+		req := api.SnapshotRequest{
+			URL: args[0],
+		}
+		var resp api.SnapshotResponse
+		err := callAPI(ctx, r.URL, r.APIKey, api.SNAPSHOT_METHOD_ID, req, &resp)
+		if err != nil {
+			log.Criticalf(ctx, "snapshot request failed: %v", err)
+			os.Exit(1)
+		}
+		m := resp.Metadata
+		fmt.Printf("size: %v\n", m.LengthBytes)
+		fmt.Printf("content type: %v\n", m.ContentType)
+		for _, d := range []struct {
+			name string
+			hex  string
+		}{
+			{"sha2-256", m.Digests.Sha2_256},
+			{"sha2-512", m.Digests.Sha2_512},
+			{"sha3-256", m.Digests.Sha3_256},
+			{"sha3-384", m.Digests.Sha3_384},
+			{"sha3-512", m.Digests.Sha3_512},
+		} {
+			if d.hex != "" {
+				fmt.Printf("%s:%s\n", d.name, d.hex)
+			}
+		}
+	},
+}
+
+func init() {
+	snapshotCmd.PersistentFlags().StringVar(&remoteFlag, "remote", "", "remote")
+}
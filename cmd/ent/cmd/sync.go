@@ -0,0 +1,83 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/google/ent/cmd/ent/config"
+	"github.com/google/ent/cmd/ent/remote"
+	"github.com/google/ent/dag"
+	"github.com/google/ent/log"
+	"github.com/ipfs/go-cid"
+	"github.com/spf13/cobra"
+	"github.com/tonistiigi/units"
+)
+
+var (
+	fromFlag string
+	toFlag   string
+)
+
+var syncCmd = &cobra.Command{
+	Use:   "sync [cid...]",
+	Short: "Copy trees from one remote to another",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := config.ReadConfig()
+		from, err := remote.GetRemote(c, fromFlag)
+		if err != nil {
+			log.Criticalf(ctx, "could not use source remote: %v", err)
+			os.Exit(1)
+		}
+		to, err := remote.GetRemote(c, toFlag)
+		if err != nil {
+			log.Criticalf(ctx, "could not use destination remote: %v", err)
+			os.Exit(1)
+		}
+		if !to.Write {
+			log.Criticalf(ctx, "destination remote %q is not writable", to.Name)
+			os.Exit(1)
+		}
+		src, err := getObjectGetter(c, from)
+		if err != nil {
+			log.Criticalf(ctx, "could not use source remote: %v", err)
+			os.Exit(1)
+		}
+		dst := remote.GetObjectStore(to)
+		for _, arg := range args {
+			root, err := cid.Decode(arg)
+			if err != nil {
+				log.Criticalf(ctx, "parse cid %q: %v", arg, err)
+				os.Exit(1)
+			}
+			stats, err := dag.Sync(ctx, src, dst, root)
+			if err != nil {
+				log.Criticalf(ctx, "sync %s: %v", root, err)
+				os.Exit(1)
+			}
+			fmt.Printf("%s [%s → %s] copied %d objects (%.0f), skipped %d\n", root, from.Name, to.Name, stats.Copied, units.Bytes(stats.Bytes), stats.Skipped)
+		}
+	},
+}
+
+func init() {
+	syncCmd.PersistentFlags().StringVar(&fromFlag, "from", "", "name of the remote to copy from")
+	syncCmd.PersistentFlags().StringVar(&toFlag, "to", "", "name of the remote to copy to")
+}
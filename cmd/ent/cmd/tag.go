@@ -0,0 +1,151 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/ent/cmd/ent/config"
+	"github.com/google/ent/cmd/ent/remote"
+	"github.com/google/ent/log"
+	"github.com/google/ent/nodeservice"
+	pb "github.com/google/ent/proto"
+	"github.com/google/ent/utils"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/spf13/cobra"
+)
+
+var tagSequenceFlag uint64
+
+var tagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "Manage signed tags, which are mutable names for trees",
+}
+
+var tagSetCmd = &cobra.Command{
+	Use:   "set [label] [cid]",
+	Short: "Sign a tag pointing to the tree with the secret key in the config, and store it on the writable remotes",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := config.ReadConfig()
+		k, err := utils.ParseSecretKey(c.SecretKey)
+		if err != nil {
+			log.Criticalf(ctx, "tags require a valid secret_key in the config: %v", err)
+			os.Exit(1)
+		}
+		label := args[0]
+		target, err := cid.Decode(args[1])
+		if err != nil {
+			log.Criticalf(ctx, "parse cid %q: %v", args[1], err)
+			os.Exit(1)
+		}
+		if target.Type() != utils.TypeDAG {
+			log.Criticalf(ctx, "tags must point to trees, not %s", target)
+			os.Exit(1)
+		}
+		remotes := []nodeservice.Remote{}
+		for _, r := range writeRemotes(ctx, c) {
+			store := remote.GetObjectStore(r)
+			if store == nil {
+				log.Criticalf(ctx, "remote %q is not writable", r.Name)
+				os.Exit(1)
+			}
+			remotes = append(remotes, *store)
+		}
+
+		sequence := tagSequenceFlag
+		if sequence == 0 {
+			// Default to the time of signing, unless a remote already has a later version.
+			sequence = uint64(time.Now().UnixNano())
+			if latest, err := nodeservice.LatestTag(ctx, remotes, &k.PublicKey, label); err == nil && latest.Tag.Sequence >= sequence {
+				sequence = latest.Tag.Sequence + 1
+			}
+		}
+		st, err := utils.SignTag(&pb.Tag{
+			Label:    label,
+			Target:   utils.DigestToProto(utils.Digest(target.Hash())),
+			Sequence: sequence,
+		}, k)
+		if err != nil {
+			log.Criticalf(ctx, "sign tag: %v", err)
+			os.Exit(1)
+		}
+		failed := 0
+		for _, r := range remotes {
+			err := r.SetTag(ctx, st)
+			if err != nil {
+				log.Errorf(ctx, "could not set tag on %s: %v", r.APIURL, err)
+				failed++
+			}
+		}
+		if failed > 0 {
+			log.Criticalf(ctx, "could not set tag on %d of %d remotes", failed, len(remotes))
+			os.Exit(1)
+		}
+		id, err := utils.PublicKeyID(&k.PublicKey)
+		if err != nil {
+			log.Criticalf(ctx, "compute public key ID: %v", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s [%s] → %s (sequence %d)\n", label, id, target, sequence)
+	},
+}
+
+var tagGetCmd = &cobra.Command{
+	Use:   "get [public key] [label]",
+	Short: "Print the tree that the latest version of a tag points to, across all remotes",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		c := config.ReadConfig()
+		pk, err := utils.ParsePublicKey(args[0])
+		if err != nil {
+			log.Criticalf(ctx, "parse public key: %v", err)
+			os.Exit(1)
+		}
+		remotes := []nodeservice.Remote{}
+		for _, r := range c.Remotes {
+			if r.Index || (remoteFlag != "" && r.Name != remoteFlag) {
+				continue
+			}
+			dialed, err := nodeservice.DialRemote(r.URL, r.APIKey, nodeservice.WithCompressor(r.Compression)...)
+			if err != nil {
+				log.Errorf(ctx, "skipping remote %q: %v", r.Name, err)
+				continue
+			}
+			remotes = append(remotes, dialed)
+		}
+		st, err := nodeservice.LatestTag(ctx, remotes, pk, args[1])
+		if err != nil {
+			log.Criticalf(ctx, "get tag: %v", err)
+			os.Exit(1)
+		}
+		target := cid.NewCidV1(utils.TypeDAG, multihash.Multihash(utils.DigestFromProto(st.Tag.Target)))
+		fmt.Printf("%s (sequence %d)\n", target, st.Tag.Sequence)
+	},
+}
+
+func init() {
+	tagCmd.PersistentFlags().StringVar(&remoteFlag, "remote", "", "remote")
+	tagSetCmd.Flags().Uint64Var(&tagSequenceFlag, "sequence", 0, "sequence number of the new version of the tag, which must be higher than that of the current one; defaults to the current time in nanoseconds")
+	tagCmd.AddCommand(tagSetCmd)
+	tagCmd.AddCommand(tagGetCmd)
+}
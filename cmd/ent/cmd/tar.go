@@ -0,0 +1,168 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/ent/dag"
+	"github.com/google/ent/log"
+	"github.com/google/ent/utils"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/schollz/progressbar/v3"
+)
+
+// tarDir accumulates the entries of a directory while reading a tar archive, since archives are not
+// required to list directories before their contents, or at all.
+type tarDir struct {
+	dirs  map[string]*tarDir
+	files map[string]cid.Cid
+}
+
+func newTarDir() *tarDir {
+	return &tarDir{
+		dirs:  map[string]*tarDir{},
+		files: map[string]cid.Cid{},
+	}
+}
+
+func (d *tarDir) dir(segments []string) *tarDir {
+	for _, s := range segments {
+		child, ok := d.dirs[s]
+		if !ok {
+			child = newTarDir()
+			d.dirs[s] = child
+		}
+		d = child
+	}
+	return d
+}
+
+// putTarFile reads a tar archive from filename (or stdin, if empty), puts all its regular files, and
+// then puts the directory tree built from them, in the same format as `ent put` on the unpacked
+// directory.
+func (p *putter) putTarFile(filename string) error {
+	var r io.Reader = os.Stdin
+	size := int64(-1)
+	name := "-"
+	if filename != "" {
+		f, err := os.Open(filename)
+		if err != nil {
+			return fmt.Errorf("could not open %q: %v", filename, err)
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return fmt.Errorf("could not stat %q: %v", filename, err)
+		}
+		r = f
+		size = info.Size()
+		name = filename
+	}
+	p.progress = progressbar.DefaultBytes(size)
+	defer p.progress.Finish()
+
+	root := newTarDir()
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("could not read tar header: %v", err)
+		}
+		segments := tarPathSegments(header.Name)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			root.dir(segments)
+		case tar.TypeReg:
+			if len(segments) == 0 {
+				return fmt.Errorf("invalid file name in tar archive: %q", header.Name)
+			}
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return fmt.Errorf("could not read %q from tar archive: %v", header.Name, err)
+			}
+			link := cid.NewCidV1(utils.TypeRaw, multihash.Multihash(utils.ComputeDigest(data)))
+			data, link, err = p.seal(data, link)
+			if err != nil {
+				return fmt.Errorf("could not seal %q: %w", header.Name, err)
+			}
+			if err := p.put(data, link, header.Name); err != nil {
+				return err
+			}
+			root.dir(segments[:len(segments)-1]).files[segments[len(segments)-1]] = link
+		default:
+			log.Warningf(context.Background(), "skipping unsupported tar entry %q of type %q", header.Name, header.Typeflag)
+		}
+	}
+	link, err := p.putTarDir(root, name+"/")
+	if err != nil {
+		return err
+	}
+	p.printRoot(link, name+"/")
+	return nil
+}
+
+func (p *putter) putTarDir(d *tarDir, name string) (cid.Cid, error) {
+	entries := make([]dag.Entry, 0, len(d.dirs)+len(d.files))
+	for n, child := range d.dirs {
+		link, err := p.putTarDir(child, name+n+"/")
+		if err != nil {
+			return cid.Cid{}, err
+		}
+		entries = append(entries, dag.Entry{Name: n, Link: link})
+	}
+	for n, link := range d.files {
+		if _, ok := d.dirs[n]; ok {
+			return cid.Cid{}, fmt.Errorf("%q is both a file and a directory", name+n)
+		}
+		entries = append(entries, dag.Entry{Name: n, Link: link})
+	}
+	// Same order as ioutil.ReadDir, so that digests match those of the unpacked directory.
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	serialized, err := utils.SerializeDAGNode(dag.NewNode(entries))
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	link := cid.NewCidV1(utils.TypeDAG, multihash.Multihash(utils.ComputeDigest(serialized)))
+	serialized, link, err = p.seal(serialized, link)
+	if err != nil {
+		return cid.Cid{}, fmt.Errorf("could not seal %q: %w", name, err)
+	}
+	if err := p.put(serialized, link, name); err != nil {
+		return cid.Cid{}, err
+	}
+	return link, nil
+}
+
+func tarPathSegments(name string) []string {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return nil
+	}
+	return strings.Split(strings.TrimPrefix(name, "/"), "/")
+}
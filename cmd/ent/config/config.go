@@ -20,8 +20,10 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/google/ent/compression"
 )
 
 const (
@@ -33,6 +35,31 @@ const (
 type Config struct {
 	Remotes   []Remote
 	SecretKey string `toml:"secret_key"`
+	Cache     Cache
+	Fetch     Fetch
+	// How to write objects to multiple writable remotes: "all" (default), "quorum" or "first".
+	WritePolicy string `toml:"write_policy"`
+	// Indexers whose signatures over index entries are trusted.
+	TrustedIndexers []TrustedIndexer `toml:"trusted_indexers"`
+}
+
+type TrustedIndexer struct {
+	Name string
+	// As printed by `ent keygen`.
+	PublicKey string `toml:"public_key"`
+}
+
+// Fetch configures how objects are fetched when multiple remotes are configured.
+type Fetch struct {
+	// One of "sequential" (default), "race" or "hedged".
+	Mode string
+	// Delay before querying the next remote in "hedged" mode.
+	HedgeDelay time.Duration `toml:"hedge_delay"`
+	// Whether to try remotes in order of past latency and error rate instead of config order.
+	Adaptive bool
+	// Whether to fetch from all the URLs listed in an index entry concurrently, instead of trying
+	// them in order.
+	RaceMirrors bool `toml:"race_mirrors"`
 }
 
 // TODO: auth
@@ -44,6 +71,40 @@ type Remote struct {
 	APIKey    string `toml:"api_key"`
 	Write     bool
 	ReadGroup uint
+	// For index remotes, whether to reject entries not signed by one of the trusted indexers.
+	RequireSignature bool `toml:"require_signature"`
+	// For index remotes, whether the index is served in the packed layout (see indexer pack).
+	Packed bool
+	// Compressor for gRPC messages, either "gzip" or "zstd"; none by default.
+	Compression string
+}
+
+// Cache configures the local cache of objects fetched from remotes.
+type Cache struct {
+	Enabled bool
+	// Defaults to "ent" under the user cache directory.
+	Dir          string
+	MaxSizeBytes int64 `toml:"max_size_bytes"`
+}
+
+const defaultCacheMaxSizeBytes = 1 << 30
+
+func (c Cache) DirName() string {
+	if c.Dir != "" {
+		return c.Dir
+	}
+	s, err := os.UserCacheDir()
+	if err != nil {
+		log.Fatalf("could not load cache dir: %v", err)
+	}
+	return filepath.Join(s, "ent")
+}
+
+func (c Cache) MaxSize() int64 {
+	if c.MaxSizeBytes > 0 {
+		return c.MaxSizeBytes
+	}
+	return defaultCacheMaxSizeBytes
 }
 
 func ReadConfig() Config {
@@ -62,6 +123,12 @@ func ReadConfig() Config {
 	if err != nil {
 		log.Fatalf("could not parse config: %v", err)
 	}
+	for _, remote := range config.Remotes {
+		err := compression.CheckGRPCCompressor(remote.Compression)
+		if err != nil {
+			log.Fatalf("invalid compression for remote %q: %v", remote.Name, err)
+		}
+	}
 	return config
 }
 
@@ -3,13 +3,9 @@ package remote
 import (
 	"fmt"
 	"log"
-	"net/url"
 
 	"github.com/google/ent/cmd/ent/config"
 	"github.com/google/ent/nodeservice"
-	pb "github.com/google/ent/proto"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
 )
 
 func GetRemote(c config.Config, remoteName string) (config.Remote, error) {
@@ -23,35 +19,11 @@ func GetRemote(c config.Config, remoteName string) (config.Remote, error) {
 
 func GetObjectStore(remote config.Remote) *nodeservice.Remote {
 	if remote.Write {
-		parsedURL, err := url.Parse(remote.URL)
+		r, err := nodeservice.DialRemote(remote.URL, remote.APIKey, nodeservice.WithCompressor(remote.Compression)...)
 		if err != nil {
-			log.Fatalf("failed to parse url: %v", err)
-		}
-
-		o := []grpc.DialOption{}
-		if parsedURL.Scheme == "http" {
-			o = append(o, grpc.WithInsecure())
-		} else {
-			o = append(o, grpc.WithTransportCredentials(credentials.NewTLS(nil)))
-		}
-		port := parsedURL.Port()
-		if port == "" {
-			if parsedURL.Scheme == "http" {
-				port = "80"
-			} else {
-				port = "443"
-			}
-		}
-		cc, err := grpc.Dial(parsedURL.Hostname()+":"+port, o...)
-		if err != nil {
-			log.Fatalf("failed to dial: %v", err)
-		}
-		client := pb.NewEntClient(cc)
-		return &nodeservice.Remote{
-			APIURL: remote.URL,
-			APIKey: remote.APIKey,
-			GRPC:   client,
+			log.Fatalf("failed to dial remote %q: %v", remote.Name, err)
 		}
+		return &r
 	} else {
 		return nil
 	}
@@ -16,20 +16,18 @@
 package main
 
 import (
+	"bufio"
 	"context"
-	"encoding/json"
+	"crypto/ecdsa"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
-	"net/url"
 	"os"
-	"path/filepath"
-	"sort"
+	"strings"
 	"sync"
 
 	"cloud.google.com/go/firestore"
 	"github.com/google/ent/index"
+	"github.com/google/ent/nodeservice"
 	"github.com/google/ent/utils"
 	"github.com/spf13/cobra"
 	"google.golang.org/api/iterator"
@@ -43,7 +41,22 @@ var (
 	firebaseProject     string
 	concurrency         int
 
-	urlFlag string
+	urlFlag  string
+	urlsFlag string
+
+	remoteFlag       string
+	apiKeyFlag       string
+	remoteMirrorFlag bool
+
+	maxFailuresFlag int
+	removeFlag      bool
+
+	secretKeyFlag string
+
+	prefixLengthFlag int
+
+	remote    *nodeservice.Remote
+	secretKey *ecdsa.PrivateKey
 )
 
 type URL struct {
@@ -52,29 +65,14 @@ type URL struct {
 
 func server(cmd *cobra.Command, args []string) {
 	ctx := context.Background()
-	client, err := firestore.NewClient(ctx, firebaseProject, option.WithCredentialsFile(firebaseCredentials))
-	if err != nil {
-		log.Fatalf("could not create client: %v", err)
-	}
 	if indexFlag == "" {
 		log.Fatal("index flag is required")
 	}
-	iter := client.Collection("urls").Documents(ctx)
-	defer iter.Stop()
+	openRemote()
+	openSecretKey()
 	wg := sync.WaitGroup{}
 	tokens := make(chan struct{}, concurrency)
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			log.Fatalf("error iterating over URLs: %v", err)
-		}
-		url := doc.Data()["url"].(string)
-		if url == "" {
-			continue
-		}
+	add := func(url string) {
 		wg.Add(1)
 		tokens <- struct{}{}
 		go func() {
@@ -88,101 +86,266 @@ func server(cmd *cobra.Command, args []string) {
 			}
 		}()
 	}
+	var err error
+	if urlsFlag != "" {
+		err = readURLs(urlsFlag, add)
+	} else {
+		err = firestoreURLs(ctx, add)
+	}
 	wg.Wait()
-}
-
-func fetchCmd(cmd *cobra.Command, args []string) {
-	e, err := fetch(urlFlag)
 	if err != nil {
-		log.Fatalf("could not fetch URL: %v", err)
+		log.Fatalf("error iterating over URLs: %v", err)
 	}
-	// Print digest to stdout.
-	fmt.Printf("%s\n", e.Digest)
 }
 
-func fetch(urlString string) (*index.IndexEntry, error) {
-	log.Print(urlString)
-	parsedURL, err := url.Parse(urlString)
+// firestoreURLs calls f for each URL in the "urls" Firestore collection.
+func firestoreURLs(ctx context.Context, f func(string)) error {
+	client, err := firestore.NewClient(ctx, firebaseProject, option.WithCredentialsFile(firebaseCredentials))
 	if err != nil {
-		return nil, fmt.Errorf("invalid URL: %w", err)
+		return fmt.Errorf("could not create client: %w", err)
 	}
+	iter := client.Collection("urls").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		url := doc.Data()["url"].(string)
+		if url == "" {
+			continue
+		}
+		f(url)
+	}
+}
 
-	if parsedURL.User != nil {
-		return nil, fmt.Errorf("non-empty user in URL")
+// readURLs calls f for each URL listed in the given file, one per line, or in stdin if filename is
+// "-". Empty lines and lines starting with "#" are ignored.
+func readURLs(filename string, f func(string)) error {
+	r := os.Stdin
+	if filename != "-" {
+		file, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
 	}
-	if parsedURL.Fragment != "" {
-		return nil, fmt.Errorf("non-empty fragment in URL")
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		url := strings.TrimSpace(scanner.Text())
+		if url == "" || strings.HasPrefix(url, "#") {
+			continue
+		}
+		f(url)
 	}
+	return scanner.Err()
+}
 
-	urlString = parsedURL.String()
-	log.Printf("fetching %q", urlString)
-
-	res, err := http.Get(urlString)
+// openSecretKey parses the key used to sign entries specified via flags, if any.
+func openSecretKey() {
+	if secretKeyFlag == "" {
+		return
+	}
+	k, err := utils.ParseSecretKey(secretKeyFlag)
 	if err != nil {
-		return nil, fmt.Errorf("could not fetch URL %q: %w", urlString, err)
+		log.Fatalf("invalid secret key: %v", err)
 	}
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("invalid error code %d (%s)", res.StatusCode, res.Status)
+	secretKey = k
+}
+
+// sign signs the entry for the given digest, if a secret key was specified.
+func sign(digest utils.Digest) error {
+	if secretKey == nil {
+		return nil
 	}
+	return index.SignEntry(indexFlag, digest, secretKey)
+}
 
-	data, err := ioutil.ReadAll(res.Body)
+// openRemote connects to the ent-server specified via flags, if any.
+func openRemote() {
+	if remoteFlag == "" {
+		return
+	}
+	r, err := nodeservice.DialRemote(remoteFlag, apiKeyFlag)
 	if err != nil {
-		return nil, fmt.Errorf("could not read HTTP body: %w", err)
+		log.Fatalf("could not dial remote: %v", err)
 	}
-	digest := utils.ComputeDigest(data)
+	remote = &r
+}
 
-	l := filepath.Join(indexFlag, index.DigestToPath(digest), index.EntryFilename)
+func fetchCmd(cmd *cobra.Command, args []string) {
+	openRemote()
+	openSecretKey()
+	e, err := fetch(urlFlag)
+	if err != nil {
+		log.Fatalf("could not fetch URL: %v", err)
+	}
+	// Print digest to stdout.
+	fmt.Printf("%s\n", e.Digest)
+}
 
-	var e index.IndexEntry
-	if _, err := os.Stat(l); err == nil {
-		log.Printf("index entry existing: %q", l)
-		bytes, err := ioutil.ReadFile(l)
-		if err != nil {
-			return nil, fmt.Errorf("could not read index entry: %w", err)
-		}
-		err = json.Unmarshal(bytes, &e)
+func fetch(urlString string) (*index.IndexEntry, error) {
+	log.Printf("fetching %q", urlString)
+	ctx := context.Background()
+	urlString, data, mediaType, err := index.Fetch(ctx, urlString)
+	if err != nil {
+		return nil, err
+	}
+	urls := []string{urlString}
+	if remote != nil {
+		// Keep a copy of the object, so that it remains available even if the original URL
+		// disappears. The server is only recorded as a mirror if it is known to serve objects
+		// without an API key, since clients fetch mirrors anonymously.
+		digest, err := remote.Put(ctx, data)
 		if err != nil {
-			return nil, fmt.Errorf("could not unmarshal JSON for index entry: %w", err)
+			return nil, fmt.Errorf("could not store object in remote: %w", err)
 		}
-
-		if sort.SearchStrings(e.URLS, urlString) != -1 {
-			// URL already in the indexed entry.
-		} else {
-			// Add the new URL.
-			e.URLS = append(e.URLS, urlString)
-			sort.Strings(e.URLS)
-		}
-
-		// Fix all fields just in case.
-		e.MediaType = http.DetectContentType(data)
-		e.Digest = string(digest)
-		e.Size = len(data)
-	} else {
-		e = index.IndexEntry{
-			MediaType: http.DetectContentType(data),
-			Digest:    string(digest),
-			Size:      len(data),
-			URLS:      []string{urlString},
+		if remoteMirrorFlag {
+			urls = append(urls, strings.TrimSuffix(remoteFlag, "/")+"/raw/"+utils.DigestToHumanString(digest))
 		}
 	}
-	log.Printf("index entry to create: %+v", e)
-
-	es, err := json.Marshal(e)
+	e, err := index.Add(indexFlag, data, mediaType, urls...)
 	if err != nil {
-		return nil, fmt.Errorf("could not marshal JSON: %w", err)
+		return nil, err
 	}
-	err = os.MkdirAll(filepath.Dir(l), 0755)
+	err = sign(utils.ComputeDigest(data))
 	if err != nil {
-		return nil, fmt.Errorf("could not create file: %w", err)
+		return nil, fmt.Errorf("could not sign entry: %w", err)
+	}
+	log.Printf("index entry updated: %+v", e)
+	return e, nil
+}
+
+func verify(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	if indexFlag == "" {
+		log.Fatal("index flag is required")
+	}
+	openSecretKey()
+	opts := index.VerifyOptions{
+		MaxFailures: maxFailuresFlag,
+		Remove:      removeFlag,
 	}
-	err = ioutil.WriteFile(l, es, 0644)
+	var (
+		mu      sync.Mutex
+		entries int
+		removed int
+		skipped int
+	)
+	wg := sync.WaitGroup{}
+	tokens := make(chan struct{}, concurrency)
+	err := index.Walk(indexFlag, func(digest utils.Digest, e *index.IndexEntry) error {
+		wg.Add(1)
+		tokens <- struct{}{}
+		go func() {
+			defer func() {
+				wg.Done()
+				<-tokens
+			}()
+			sigs, err := index.ReadSignatures(indexFlag, digest)
+			if err != nil {
+				log.Printf("%s: could not read signatures: %v", utils.DigestToHumanString(digest), err)
+				return
+			}
+			bad, changed := index.Verify(ctx, digest, e, opts)
+			if len(sigs) > 0 {
+				// Rewriting a signed entry invalidates all its signatures, so only do so if
+				// something other than the verification times changed, and if the entry can be
+				// signed again by all the keys that signed it.
+				if !changed {
+					return
+				}
+				if !canResign(sigs) {
+					log.Printf("%s: not recording changes, since the entry is signed by keys other than --secret-key", utils.DigestToHumanString(digest))
+					mu.Lock()
+					skipped++
+					mu.Unlock()
+					return
+				}
+			}
+			for _, u := range bad {
+				if opts.Remove {
+					log.Printf("%s: removing %q", utils.DigestToHumanString(digest), u)
+				} else {
+					log.Printf("%s: quarantining %q (%s)", utils.DigestToHumanString(digest), u, e.Status[u].Status)
+				}
+			}
+			err = index.WriteEntry(indexFlag, digest, e)
+			if err == nil {
+				err = sign(digest)
+			}
+			if err != nil {
+				log.Printf("could not write entry: %v", err)
+			}
+			mu.Lock()
+			entries++
+			removed += len(bad)
+			mu.Unlock()
+		}()
+		return nil
+	})
+	wg.Wait()
 	if err != nil {
-		return nil, fmt.Errorf("could not write to file: %w", err)
+		log.Fatalf("could not walk index: %v", err)
 	}
+	log.Printf("verified %d entries, removed %d URLs", entries, removed)
+	if skipped > 0 {
+		log.Printf("left %d signed entries unchanged", skipped)
+	}
+}
 
-	log.Printf("index entry created: %q", l)
+// canResign returns whether all the given signatures were made with the secret key, if any, so
+// that the entry they cover can be signed again after being rewritten.
+func canResign(sigs []index.Signature) bool {
+	if secretKey == nil {
+		return false
+	}
+	pk, err := utils.FormatPublicKey(&secretKey.PublicKey)
+	if err != nil {
+		return false
+	}
+	for _, s := range sigs {
+		if s.PublicKey != pk {
+			return false
+		}
+	}
+	return true
+}
 
-	return &e, nil
+func pack(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+	if indexFlag == "" {
+		log.Fatal("index flag is required")
+	}
+	openRemote()
+	openSecretKey()
+	m, shards, err := index.Pack(indexFlag, prefixLengthFlag)
+	if err != nil {
+		log.Fatalf("could not pack index: %v", err)
+	}
+	if secretKey != nil {
+		err := index.SignManifest(indexFlag, secretKey)
+		if err != nil {
+			log.Fatalf("could not sign manifest: %v", err)
+		}
+	}
+	if remote != nil {
+		for _, b := range shards {
+			_, err := remote.Put(ctx, b)
+			if err != nil {
+				log.Fatalf("could not store shard in remote: %v", err)
+			}
+		}
+	}
+	entries := 0
+	for _, s := range m.Shards {
+		entries += s.Count
+	}
+	log.Printf("packed %d entries into %d shards", entries, len(m.Shards))
 }
 
 func main() {
@@ -198,6 +361,11 @@ func main() {
 	serverCmd.PersistentFlags().StringVar(&firebaseProject, "firebase-project", "", "Firebase project name")
 	serverCmd.PersistentFlags().StringVar(&firebaseCredentials, "firebase-credentials", "", "file with Firebase credentials")
 	serverCmd.PersistentFlags().IntVar(&concurrency, "concurrency", 10, "HTTP fetch concurrency")
+	serverCmd.PersistentFlags().StringVar(&urlsFlag, "urls", "", "file listing the URLs to index, one per line, or - for stdin (instead of Firestore)")
+	serverCmd.PersistentFlags().StringVar(&remoteFlag, "remote", "", "optional ent-server in which to store the fetched objects")
+	serverCmd.PersistentFlags().StringVar(&apiKeyFlag, "api-key", "", "API key for the ent-server")
+	serverCmd.PersistentFlags().BoolVar(&remoteMirrorFlag, "remote-mirror", false, "record the ent-server as a mirror; only use if it allows anonymous reads")
+	serverCmd.PersistentFlags().StringVar(&secretKeyFlag, "secret-key", "", "optional secret key (as printed by ent keygen) with which to sign index entries")
 	rootCmd.AddCommand(serverCmd)
 
 	getCmd := &cobra.Command{
@@ -207,7 +375,35 @@ func main() {
 	}
 	getCmd.PersistentFlags().StringVar(&indexFlag, "index", "", "path to index repository")
 	getCmd.PersistentFlags().StringVar(&urlFlag, "url", "", "url of the entry to index")
+	getCmd.PersistentFlags().StringVar(&remoteFlag, "remote", "", "optional ent-server in which to store the fetched object")
+	getCmd.PersistentFlags().StringVar(&apiKeyFlag, "api-key", "", "API key for the ent-server")
+	getCmd.PersistentFlags().BoolVar(&remoteMirrorFlag, "remote-mirror", false, "record the ent-server as a mirror; only use if it allows anonymous reads")
+	getCmd.PersistentFlags().StringVar(&secretKeyFlag, "secret-key", "", "optional secret key (as printed by ent keygen) with which to sign index entries")
 	rootCmd.AddCommand(getCmd)
 
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Re-download all the URLs in the index, and remove the ones that are dead or serve different content",
+		Run:   verify,
+	}
+	verifyCmd.PersistentFlags().StringVar(&indexFlag, "index", "", "path to index repository")
+	verifyCmd.PersistentFlags().IntVar(&concurrency, "concurrency", 10, "HTTP fetch concurrency")
+	verifyCmd.PersistentFlags().IntVar(&maxFailuresFlag, "max-failures", 3, "number of consecutive failed fetches after which a URL is removed (0 to never remove)")
+	verifyCmd.PersistentFlags().BoolVar(&removeFlag, "remove", false, "drop bad URLs entirely instead of moving them to the quarantine list")
+	verifyCmd.PersistentFlags().StringVar(&secretKeyFlag, "secret-key", "", "optional secret key (as printed by ent keygen) with which to sign index entries")
+	rootCmd.AddCommand(verifyCmd)
+
+	packCmd := &cobra.Command{
+		Use:   "pack",
+		Short: "Write the packed layout of the index, with entries grouped into shards by digest prefix",
+		Run:   pack,
+	}
+	packCmd.PersistentFlags().StringVar(&indexFlag, "index", "", "path to index repository")
+	packCmd.PersistentFlags().IntVar(&prefixLengthFlag, "prefix-length", 2, "number of hex characters of the digest used to group entries into shards")
+	packCmd.PersistentFlags().StringVar(&remoteFlag, "remote", "", "optional ent-server in which to store the shards")
+	packCmd.PersistentFlags().StringVar(&apiKeyFlag, "api-key", "", "API key for the ent-server")
+	packCmd.PersistentFlags().StringVar(&secretKeyFlag, "secret-key", "", "optional secret key (as printed by ent keygen) with which to sign the manifest")
+	rootCmd.AddCommand(packCmd)
+
 	rootCmd.Execute()
 }
@@ -0,0 +1,179 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package compression decides whether and how objects are compressed, at rest and on the wire.
+// Digests are always computed over the uncompressed bytes.
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content codings, as used in HTTP and gRPC.
+const (
+	Zstd = "zstd"
+	Gzip = "gzip"
+)
+
+const (
+	// Objects smaller than this are never compressed, since the savings would be negligible.
+	minSize = 256
+	// Compressibility is measured on a prefix of this size, so that large incompressible objects
+	// are not compressed in full just to find out.
+	sampleSize = 64 * 1024
+	// Compression is only worth it if it saves at least 10%.
+	maxRatio = 0.9
+)
+
+var (
+	encoder, _ = zstd.NewWriter(nil)
+	decoder, _ = zstd.NewReader(nil)
+)
+
+// Compress returns the zstd compression of b.
+func Compress(b []byte) []byte {
+	return encoder.EncodeAll(b, nil)
+}
+
+// Decompress returns the decompression of the zstd frames in b.
+func Decompress(b []byte) ([]byte, error) {
+	return decoder.DecodeAll(b, nil)
+}
+
+// HeaderMaxSize is the number of bytes at the start of compressed data that is enough for
+// DecompressedSize.
+const HeaderMaxSize = zstd.HeaderMaxSize
+
+// DecompressedSize returns the size of b after decompression, if recorded in its header.
+func DecompressedSize(b []byte) (uint64, bool) {
+	h := zstd.Header{}
+	err := h.Decode(b)
+	if err != nil || !h.HasFCS {
+		return 0, false
+	}
+	return h.FrameContentSize, true
+}
+
+// CompressIfWorthwhile returns the zstd compression of b, and whether it saves enough to be worth
+// the cost of decompressing it.
+func CompressIfWorthwhile(b []byte) ([]byte, bool) {
+	if len(b) > sampleSize && !compressible(b) {
+		return nil, false
+	}
+	compressed := Compress(b)
+	return compressed, worthwhile(len(b), compressed, len(b))
+}
+
+// Worthwhile returns whether b is likely to be worth compressing, without compressing all of it if
+// it is large.
+func Worthwhile(b []byte) bool {
+	return compressible(b)
+}
+
+// compressible returns whether b is likely to be worth compressing, based on how well a sample of
+// it compresses.
+func compressible(b []byte) bool {
+	sample := b
+	if len(sample) > sampleSize {
+		sample = sample[:sampleSize]
+	}
+	return worthwhile(len(b), Compress(sample), len(sample))
+}
+
+// worthwhile returns whether compressed, the compression of the first n bytes of an object of the
+// given size, saves enough.
+func worthwhile(size int, compressed []byte, n int) bool {
+	return size >= minSize && float64(len(compressed)) <= maxRatio*float64(n)
+}
+
+// Negotiate returns the supported content coding preferred by the client, based on the value of
+// its Accept-Encoding header, or "" if there is none.
+func Negotiate(acceptEncoding string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if k == "q" {
+				f, err := strconv.ParseFloat(v, 64)
+				if err == nil {
+					q = f
+				}
+			}
+		}
+		accepted[coding] = q > 0
+	}
+	// The server preference takes precedence over the order in the header.
+	for _, coding := range []string{Zstd, Gzip} {
+		if accepted[coding] {
+			return coding
+		}
+	}
+	return ""
+}
+
+// Encode compresses b with the given content coding.
+func Encode(coding string, b []byte) ([]byte, error) {
+	switch coding {
+	case Zstd:
+		return Compress(b), nil
+	case Gzip:
+		buf := bytes.Buffer{}
+		w := gzip.NewWriter(&buf)
+		_, err := w.Write(b)
+		if err != nil {
+			return nil, err
+		}
+		err = w.Close()
+		if err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported content coding: %q", coding)
+	}
+}
+
+// EncodeResponse returns the body of a response with contents b, compressed with the coding
+// preferred by the client if b is compressible, and that coding, or b itself and "".
+func EncodeResponse(acceptEncoding string, b []byte) ([]byte, string) {
+	coding := Negotiate(acceptEncoding)
+	switch coding {
+	case "":
+		return b, ""
+	case Zstd:
+		compressed, ok := CompressIfWorthwhile(b)
+		if !ok {
+			return b, ""
+		}
+		return compressed, coding
+	}
+	if !compressible(b) {
+		return b, ""
+	}
+	encoded, err := Encode(coding, b)
+	if err != nil {
+		return b, ""
+	}
+	return encoded, coding
+}
@@ -0,0 +1,206 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"io"
+	"runtime"
+	"testing"
+
+	"google.golang.org/grpc/encoding"
+)
+
+func TestCompressIfWorthwhile(t *testing.T) {
+	text := bytes.Repeat([]byte("hello world\n"), 1000)
+	compressed, ok := CompressIfWorthwhile(text)
+	if !ok {
+		t.Fatalf("expected text to be worth compressing")
+	}
+	decompressed, err := Decompress(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decompressed, text) {
+		t.Fatalf("round trip mismatch")
+	}
+	if size, ok := DecompressedSize(compressed); !ok || size != uint64(len(text)) {
+		t.Fatalf("DecompressedSize = %d, %v", size, ok)
+	}
+
+	random := make([]byte, 200*1024)
+	rand.Read(random)
+	if _, ok := CompressIfWorthwhile(random); ok {
+		t.Fatalf("expected random bytes not to be worth compressing")
+	}
+	if _, ok := CompressIfWorthwhile([]byte("short")); ok {
+		t.Fatalf("expected short value not to be worth compressing")
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for _, c := range []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip, deflate, br", Gzip},
+		{"gzip, zstd", Zstd},
+		{"zstd;q=0, gzip;q=0.5", Gzip},
+		{"GZIP", Gzip},
+	} {
+		if got := Negotiate(c.header); got != c.want {
+			t.Errorf("Negotiate(%q) = %q, want %q", c.header, got, c.want)
+		}
+	}
+}
+
+func TestEncodeResponse(t *testing.T) {
+	text := bytes.Repeat([]byte("hello world\n"), 1000)
+	b, coding := EncodeResponse("gzip", text)
+	if coding != Gzip {
+		t.Fatalf("coding = %q, want %q", coding, Gzip)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompressed, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decompressed, text) {
+		t.Fatalf("round trip mismatch")
+	}
+	if _, coding := EncodeResponse("br", text); coding != "" {
+		t.Fatalf("unexpected coding %q", coding)
+	}
+}
+
+func TestGRPCDecompress(t *testing.T) {
+	c := encoding.GetCompressor(Zstd)
+	compress := func(r io.Reader) []byte {
+		buf := bytes.Buffer{}
+		w, err := c.Compress(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(w, r); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	text := bytes.Repeat([]byte("hello world\n"), 1000)
+	compressed := compress(bytes.NewReader(text))
+	// Decoders are reused across messages, including those that were not read in full.
+	for i := 0; i < 3; i++ {
+		r, err := c.Decompress(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 {
+			if _, err := io.ReadFull(r, make([]byte, 10)); err != nil {
+				t.Fatal(err)
+			}
+			r.(io.Closer).Close()
+			continue
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, text) {
+			t.Fatalf("round trip mismatch")
+		}
+	}
+
+	// A message that decompresses to far more than is read must not be decompressed in full.
+	const bombSize = 1 << 30
+	bomb := compress(io.LimitReader(zeros{}, bombSize))
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	r, err := c.Decompress(bytes.NewReader(bomb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := io.Copy(io.Discard, io.LimitReader(r, 1<<20))
+	if err != nil || n != 1<<20 {
+		t.Fatalf("read %d bytes: %v", n, err)
+	}
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > bombSize/8 {
+		t.Errorf("allocated %d bytes to read %d", allocated, n)
+	}
+	r.(io.Closer).Close()
+
+	r, err = c.Decompress(bytes.NewReader([]byte("not zstd")))
+	if err == nil {
+		_, err = io.ReadAll(r)
+	}
+	if err == nil {
+		t.Errorf("expected invalid message to fail")
+	}
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestSendCompressor(t *testing.T) {
+	text := bytes.Repeat([]byte("hello world\n"), 1000)
+	random := make([]byte, 4096)
+	rand.Read(random)
+	for _, tc := range []struct {
+		b          []byte
+		advertised []string
+		want       string
+	}{
+		{text, []string{Gzip, Zstd}, Zstd},
+		{text, []string{Gzip}, Gzip},
+		{text, nil, encoding.Identity},
+		{random, []string{Gzip, Zstd}, encoding.Identity},
+		{[]byte("hello"), []string{Zstd}, encoding.Identity},
+	} {
+		if got := SendCompressor(tc.b, tc.advertised); got != tc.want {
+			t.Errorf("SendCompressor(%d bytes, %q) = %q, want %q", len(tc.b), tc.advertised, got, tc.want)
+		}
+	}
+}
+
+func TestCheckGRPCCompressor(t *testing.T) {
+	for _, name := range []string{"", Zstd, Gzip} {
+		if err := CheckGRPCCompressor(name); err != nil {
+			t.Errorf("CheckGRPCCompressor(%q) = %v", name, err)
+		}
+	}
+	for _, name := range []string{"zst", "identity", "brotli"} {
+		if err := CheckGRPCCompressor(name); err == nil {
+			t.Errorf("CheckGRPCCompressor(%q) succeeded, want error", name)
+		}
+	}
+}
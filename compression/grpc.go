@@ -0,0 +1,128 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compression
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/encoding"
+
+	// Registers the gzip compressor for gRPC.
+	_ "google.golang.org/grpc/encoding/gzip"
+)
+
+// grpcCompressor implements zstd compression of gRPC messages. Servers reply with the compressor
+// used by the client, as long as they also have it registered.
+type grpcCompressor struct{}
+
+// Decoders are reused across messages, since allocating them is comparatively expensive.
+var decoders sync.Pool
+
+func init() {
+	encoding.RegisterCompressor(grpcCompressor{})
+}
+
+func (grpcCompressor) Name() string {
+	return Zstd
+}
+
+func (grpcCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+}
+
+// Decompress returns a reader that decompresses the message as it is read, so that gRPC can stop
+// reading once the message exceeds its maximum size, regardless of how large it would be once
+// decompressed in full.
+func (grpcCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	d, ok := decoders.Get().(*zstd.Decoder)
+	if !ok {
+		var err error
+		d, err = zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+	} else if err := d.Reset(r); err != nil {
+		d.Close()
+		return nil, err
+	}
+	return &messageReader{d: d}, nil
+}
+
+// messageReader reads a decompressed message. Its zstd decoder is returned to the pool once the message
+// has been read in full or the reader is closed, and discarded if the message is invalid.
+type messageReader struct {
+	d   *zstd.Decoder
+	err error
+}
+
+func (r *messageReader) Read(p []byte) (int, error) {
+	if r.d == nil {
+		return 0, r.err
+	}
+	n, err := r.d.Read(p)
+	if err == io.EOF {
+		r.release(err)
+	} else if err != nil {
+		r.d.Close()
+		r.d = nil
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *messageReader) Close() error {
+	if r.d != nil {
+		r.release(zstd.ErrDecoderClosed)
+	}
+	return nil
+}
+
+// release returns the zstd decoder to the pool, after which reads return err.
+func (r *messageReader) release(err error) {
+	// Drops the reference to the input.
+	if e := r.d.Reset(nil); e != nil {
+		r.d.Close()
+	} else {
+		decoders.Put(r.d)
+	}
+	r.d = nil
+	r.err = err
+}
+
+// SendCompressor returns the name of the gRPC compressor to send a message containing b with,
+// among those advertised by the peer: the preferred one if b is worth compressing, or the identity
+// otherwise.
+func SendCompressor(b []byte, advertised []string) string {
+	coding := Negotiate(strings.Join(advertised, ","))
+	if coding == "" || !Worthwhile(b) {
+		return encoding.Identity
+	}
+	return coding
+}
+
+// CheckGRPCCompressor returns an error if name is neither empty nor a gRPC compressor that is
+// registered by this package.
+func CheckGRPCCompressor(name string) error {
+	switch name {
+	case "", Zstd, Gzip:
+		return nil
+	}
+	return fmt.Errorf("unsupported compressor %q, must be %q or %q", name, Zstd, Gzip)
+}
@@ -0,0 +1,127 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dag provides helpers to navigate the directory trees created by `ent put`, in which each
+// directory is a DAG node whose bytes contain the newline-separated names of its links.
+package dag
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/ent/nodeservice"
+	"github.com/google/ent/utils"
+	"github.com/ipfs/go-cid"
+)
+
+// Entry is a named link within a directory node.
+type Entry struct {
+	Name string
+	Link cid.Cid
+}
+
+// Entries returns the named links of a directory node, in the order in which they are stored.
+func Entries(node *utils.DAGNode) []Entry {
+	names := strings.Split(string(node.Bytes), "\n")
+	entries := make([]Entry, len(node.Links))
+	for i, link := range node.Links {
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		entries[i] = Entry{
+			Name: name,
+			Link: link,
+		}
+	}
+	return entries
+}
+
+// GetEntries fetches the directory node identified by link and returns its named links.
+func GetEntries(ctx context.Context, og nodeservice.ObjectGetter, link cid.Cid) ([]Entry, error) {
+	digest := utils.Digest(link.Hash())
+	nodeRaw, err := og.Get(ctx, digest)
+	if err != nil {
+		return nil, fmt.Errorf("could not get blob %s: %w", digest, err)
+	}
+	node, err := utils.ParseDAGNode(nodeRaw)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse node %s: %w", digest, err)
+	}
+	return Entries(node), nil
+}
+
+// Size returns the size in bytes of the object identified by link.
+func Size(ctx context.Context, og nodeservice.ObjectGetter, link cid.Cid) (int64, error) {
+	digest := utils.Digest(link.Hash())
+	m, err := og.GetMetadata(ctx, digest)
+	if err == nil {
+		return int64(m.Size), nil
+	}
+	b, err := og.Get(ctx, digest)
+	if err != nil {
+		return 0, fmt.Errorf("could not get blob %s: %w", digest, err)
+	}
+	return int64(len(b)), nil
+}
+
+// NewNode builds a directory node from its named links, preserving their order.
+func NewNode(entries []Entry) *utils.DAGNode {
+	node := utils.DAGNode{
+		Links: make([]cid.Cid, 0, len(entries)),
+	}
+	data := ""
+	for _, e := range entries {
+		data += e.Name + "\n"
+		node.Links = append(node.Links, e.Link)
+	}
+	node.Bytes = []byte(data)
+	return &node
+}
+
+// Walk calls f on every object reachable from link, including link itself. Each object is visited
+// only once, and directory nodes are visited before their children.
+func Walk(ctx context.Context, og nodeservice.ObjectGetter, link cid.Cid, f func(cid.Cid, []byte) error) error {
+	return walk(ctx, og, link, f, map[cid.Cid]bool{})
+}
+
+func walk(ctx context.Context, og nodeservice.ObjectGetter, link cid.Cid, f func(cid.Cid, []byte) error, seen map[cid.Cid]bool) error {
+	if seen[link] {
+		return nil
+	}
+	seen[link] = true
+	digest := utils.Digest(link.Hash())
+	b, err := og.Get(ctx, digest)
+	if err != nil {
+		return fmt.Errorf("could not get blob %s: %w", digest, err)
+	}
+	if err := f(link, b); err != nil {
+		return err
+	}
+	if link.Type() != utils.TypeDAG {
+		return nil
+	}
+	node, err := utils.ParseDAGNode(b)
+	if err != nil {
+		return fmt.Errorf("could not parse node %s: %w", digest, err)
+	}
+	for _, l := range node.Links {
+		if err := walk(ctx, og, l, f, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
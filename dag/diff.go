@@ -0,0 +1,178 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dag
+
+import (
+	"context"
+	"sort"
+
+	"github.com/google/ent/nodeservice"
+	"github.com/google/ent/utils"
+	"github.com/ipfs/go-cid"
+)
+
+type ChangeKind int
+
+const (
+	Added ChangeKind = iota
+	Removed
+	Modified
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Modified:
+		return "modified"
+	default:
+		return "unknown"
+	}
+}
+
+// Change describes a file that differs between two trees. OldSize is only set for removed and
+// modified files, NewSize only for added and modified files.
+type Change struct {
+	Kind    ChangeKind
+	Path    string
+	OldSize int64
+	NewSize int64
+}
+
+// Diff compares the trees rooted at a and b, and returns the files that were added, removed or
+// modified going from a to b, in path order. Subtrees with the same CID are identical, and are
+// skipped without being fetched.
+func Diff(ctx context.Context, og nodeservice.ObjectGetter, a cid.Cid, b cid.Cid) ([]Change, error) {
+	d := differ{
+		og: og,
+	}
+	err := d.diff(ctx, "", a, b)
+	if err != nil {
+		return nil, err
+	}
+	return d.changes, nil
+}
+
+type differ struct {
+	og      nodeservice.ObjectGetter
+	changes []Change
+}
+
+func (d *differ) diff(ctx context.Context, path string, a cid.Cid, b cid.Cid) error {
+	if a.Equals(b) {
+		return nil
+	}
+	if a.Type() == utils.TypeDAG && b.Type() == utils.TypeDAG {
+		entriesA, err := GetEntries(ctx, d.og, a)
+		if err != nil {
+			return err
+		}
+		entriesB, err := GetEntries(ctx, d.og, b)
+		if err != nil {
+			return err
+		}
+		linksA := map[string]cid.Cid{}
+		linksB := map[string]cid.Cid{}
+		names := []string{}
+		for _, e := range entriesA {
+			linksA[e.Name] = e.Link
+			names = append(names, e.Name)
+		}
+		for _, e := range entriesB {
+			linksB[e.Name] = e.Link
+			if _, ok := linksA[e.Name]; !ok {
+				names = append(names, e.Name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			linkA, okA := linksA[name]
+			linkB, okB := linksB[name]
+			p := path + "/" + name
+			var err error
+			switch {
+			case okA && okB:
+				err = d.diff(ctx, p, linkA, linkB)
+			case okA:
+				err = d.walk(ctx, Removed, p, linkA)
+			case okB:
+				err = d.walk(ctx, Added, p, linkB)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if a.Type() == utils.TypeRaw && b.Type() == utils.TypeRaw {
+		sizeA, err := Size(ctx, d.og, a)
+		if err != nil {
+			return err
+		}
+		sizeB, err := Size(ctx, d.og, b)
+		if err != nil {
+			return err
+		}
+		d.changes = append(d.changes, Change{
+			Kind:    Modified,
+			Path:    path,
+			OldSize: sizeA,
+			NewSize: sizeB,
+		})
+		return nil
+	}
+	// A file was replaced by a directory or vice versa.
+	if err := d.walk(ctx, Removed, path, a); err != nil {
+		return err
+	}
+	return d.walk(ctx, Added, path, b)
+}
+
+// walk records every file under link as added or removed.
+func (d *differ) walk(ctx context.Context, kind ChangeKind, path string, link cid.Cid) error {
+	if link.Type() == utils.TypeDAG {
+		entries, err := GetEntries(ctx, d.og, link)
+		if err != nil {
+			return err
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Name < entries[j].Name
+		})
+		for _, e := range entries {
+			if err := d.walk(ctx, kind, path+"/"+e.Name, e.Link); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	size, err := Size(ctx, d.og, link)
+	if err != nil {
+		return err
+	}
+	c := Change{
+		Kind: kind,
+		Path: path,
+	}
+	if kind == Removed {
+		c.OldSize = size
+	} else {
+		c.NewSize = size
+	}
+	d.changes = append(d.changes, c)
+	return nil
+}
@@ -0,0 +1,93 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dag
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/google/ent/datastore"
+	"github.com/google/ent/objectstore"
+	"github.com/google/ent/utils"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+func putRaw(t *testing.T, o objectstore.Store, s string) cid.Cid {
+	digest, err := o.Put(context.Background(), []byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cid.NewCidV1(utils.TypeRaw, multihash.Multihash(digest))
+}
+
+func putDir(t *testing.T, o objectstore.Store, entries ...Entry) cid.Cid {
+	node := utils.DAGNode{}
+	for _, e := range entries {
+		node.Bytes = append(node.Bytes, []byte(e.Name+"\n")...)
+		node.Links = append(node.Links, e.Link)
+	}
+	b, err := utils.SerializeDAGNode(&node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := o.Put(context.Background(), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cid.NewCidV1(utils.TypeDAG, multihash.Multihash(digest))
+}
+
+func TestDiff(t *testing.T) {
+	o := objectstore.Store{
+		Inner: datastore.InMemory{
+			Inner: make(map[string][]byte),
+		},
+	}
+	unchanged := putDir(t, o, Entry{"x", putRaw(t, o, "x")})
+	a := putDir(t, o,
+		Entry{"common", unchanged},
+		Entry{"modified", putRaw(t, o, "old")},
+		Entry{"removed", putRaw(t, o, "removed")},
+	)
+	b := putDir(t, o,
+		Entry{"added", putDir(t, o, Entry{"y", putRaw(t, o, "yy")})},
+		Entry{"common", unchanged},
+		Entry{"modified", putRaw(t, o, "new!")},
+	)
+
+	changes, err := Diff(context.Background(), o, a, b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Change{
+		{Kind: Added, Path: "/added/y", NewSize: 2},
+		{Kind: Modified, Path: "/modified", OldSize: 3, NewSize: 4},
+		{Kind: Removed, Path: "/removed", OldSize: 7},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("unexpected changes:\ngot:  %+v\nwant: %+v", changes, want)
+	}
+
+	changes, err = Diff(context.Background(), o, a, a)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("expected no changes, got %+v", changes)
+	}
+}
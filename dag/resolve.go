@@ -0,0 +1,56 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/ent/log"
+	"github.com/google/ent/nodeservice"
+	"github.com/google/ent/utils"
+	"github.com/ipfs/go-cid"
+)
+
+// ErrPathNotFound is returned by ResolvePath if a directory along the path has no entry with the
+// requested name, as opposed to errors fetching or parsing the objects along it.
+var ErrPathNotFound = errors.New("path not found")
+
+// ResolvePath follows the named path segments starting from link, and returns the link they point
+// to. Resolution stops at the first raw object or empty segment, so that a trailing slash resolves
+// to the directory itself.
+func ResolvePath(ctx context.Context, og nodeservice.ObjectGetter, link cid.Cid, segments []string) (cid.Cid, error) {
+	if len(segments) == 0 || link.Type() == utils.TypeRaw {
+		return link, nil
+	}
+	selector := segments[0]
+	if selector == "" {
+		return link, nil
+	}
+	entries, err := GetEntries(ctx, og, link)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	log.Debugf(ctx, "selector: %v", selector)
+	for _, e := range entries {
+		if e.Name == selector {
+			log.Debugf(ctx, "next: %v", e.Link)
+			return ResolvePath(ctx, og, e.Link, segments[1:])
+		}
+	}
+	return cid.Cid{}, fmt.Errorf("could not find link %s/%v: %w", utils.Digest(link.Hash()), selector, ErrPathNotFound)
+}
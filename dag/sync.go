@@ -0,0 +1,100 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dag
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/google/ent/log"
+	"github.com/google/ent/nodeservice"
+	"github.com/google/ent/utils"
+	"github.com/ipfs/go-cid"
+)
+
+type SyncStats struct {
+	// Objects copied to the destination.
+	Copied int
+	// Objects (or whole subtrees) that the destination already had.
+	Skipped int
+	// Bytes copied to the destination.
+	Bytes int64
+}
+
+// Sync copies the tree rooted at link from src to dst, skipping objects that dst already has.
+//
+// Children are always copied before their parents, so a directory node is only present in dst once
+// its whole subtree is. This makes it safe to resume an interrupted sync: any subtree whose root is
+// already in dst is skipped without being traversed.
+func Sync(ctx context.Context, src nodeservice.ObjectGetter, dst nodeservice.ObjectStore, link cid.Cid) (SyncStats, error) {
+	s := syncer{
+		src:  src,
+		dst:  dst,
+		seen: map[cid.Cid]bool{},
+	}
+	err := s.sync(ctx, link)
+	return s.stats, err
+}
+
+type syncer struct {
+	src   nodeservice.ObjectGetter
+	dst   nodeservice.ObjectStore
+	seen  map[cid.Cid]bool
+	stats SyncStats
+}
+
+func (s *syncer) sync(ctx context.Context, link cid.Cid) error {
+	if s.seen[link] {
+		return nil
+	}
+	s.seen[link] = true
+	digest := utils.Digest(link.Hash())
+	ok, err := s.dst.Has(ctx, digest)
+	if err != nil {
+		return fmt.Errorf("could not check existence of %s: %w", digest, err)
+	}
+	if ok {
+		s.stats.Skipped++
+		return nil
+	}
+	b, err := s.src.Get(ctx, digest)
+	if err != nil {
+		return fmt.Errorf("could not get blob %s: %w", digest, err)
+	}
+	if link.Type() == utils.TypeDAG {
+		node, err := utils.ParseDAGNode(b)
+		if err != nil {
+			return fmt.Errorf("could not parse node %s: %w", digest, err)
+		}
+		for _, l := range node.Links {
+			if err := s.sync(ctx, l); err != nil {
+				return err
+			}
+		}
+	}
+	putDigest, err := s.dst.Put(ctx, b)
+	if err != nil {
+		return fmt.Errorf("could not put blob %s: %w", digest, err)
+	}
+	if !bytes.Equal(putDigest, digest) {
+		return fmt.Errorf("mismatching digest: wanted:%q got:%q", digest.String(), putDigest.String())
+	}
+	log.Debugf(ctx, "copied %s", utils.DigestForLog(digest))
+	s.stats.Copied++
+	s.stats.Bytes += int64(len(b))
+	return nil
+}
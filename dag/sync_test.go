@@ -0,0 +1,63 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dag
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/ent/datastore"
+	"github.com/google/ent/objectstore"
+	"github.com/google/ent/utils"
+)
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	src := objectstore.Store{
+		Inner: datastore.InMemory{
+			Inner: make(map[string][]byte),
+		},
+	}
+	dst := objectstore.Store{
+		Inner: datastore.InMemory{
+			Inner: make(map[string][]byte),
+		},
+	}
+	shared := putRaw(t, src, "shared")
+	sub := putDir(t, src, Entry{"a", shared}, Entry{"b", putRaw(t, src, "b")})
+	root := putDir(t, src, Entry{"sub", sub}, Entry{"c", shared})
+
+	// Simulate an earlier, interrupted sync that only copied part of the tree.
+	b, _ := src.Get(ctx, utils.Digest(shared.Hash()))
+	dst.Put(ctx, b)
+
+	stats, err := Sync(ctx, src, dst, root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Copied != 3 || stats.Skipped != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	// All objects are now in dst, so only the root is checked.
+	stats, err = Sync(ctx, src, dst, root)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Copied != 0 || stats.Skipped != 1 || stats.Bytes != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
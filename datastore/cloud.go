@@ -22,6 +22,8 @@ import (
 
 	"cloud.google.com/go/storage"
 	"github.com/google/ent/log"
+	"github.com/google/ent/mediatype"
+	"github.com/google/ent/utils"
 )
 
 // Cloud is an implementation of DataStore using a Google Cloud Storage bucket.
@@ -32,7 +34,9 @@ type Cloud struct {
 
 func (s Cloud) Get(ctx context.Context, name string) ([]byte, error) {
 	rc, err := s.Client.Bucket(s.BucketName).Object(name).NewReader(ctx)
-	if err != nil {
+	if err == storage.ErrObjectNotExist {
+		return nil, ErrNotFound
+	} else if err != nil {
 		return nil, err
 	}
 	body, err := ioutil.ReadAll(rc)
@@ -46,11 +50,32 @@ func (s Cloud) Get(ctx context.Context, name string) ([]byte, error) {
 	return body, nil
 }
 
+func (s Cloud) GetRange(ctx context.Context, name string, offset int64, length int64) ([]byte, error) {
+	rc, err := s.Client.Bucket(s.BucketName).Object(name).NewRangeReader(ctx, offset, length)
+	if err == storage.ErrObjectNotExist {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	body, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("error reading from cloud storage: %v", err)
+	}
+	return body, nil
+}
+
 func (s Cloud) Put(ctx context.Context, name string, value []byte) error {
+	// Only the contents are available here, so this is based on magic bytes alone.
+	return s.PutWithMediaType(ctx, name, value, mediatype.Detect("", "", value))
+}
+
+func (s Cloud) PutWithMediaType(ctx context.Context, name string, value []byte, mediaType string) error {
 	o := s.Client.Bucket(s.BucketName).Object(name)
 	attr, err := o.Attrs(ctx)
 	if err == storage.ErrObjectNotExist {
 		wc := o.NewWriter(ctx)
+		wc.ContentType = mediaType
 		_, err := wc.Write(value)
 		if err != nil {
 			return fmt.Errorf("error writing to cloud storage: %v", err)
@@ -67,6 +92,20 @@ func (s Cloud) Put(ctx context.Context, name string, value []byte) error {
 	return nil
 }
 
+func (s Cloud) GetMetadata(ctx context.Context, name string) (utils.Metadata, error) {
+	attrs, err := s.Client.Bucket(s.BucketName).Object(name).Attrs(ctx)
+	if err == storage.ErrObjectNotExist {
+		return utils.Metadata{}, ErrNotFound
+	} else if err != nil {
+		return utils.Metadata{}, fmt.Errorf("error getting attrs from cloud storage: %v", err)
+	}
+	return utils.Metadata{
+		Size:         uint64(attrs.Size),
+		MediaType:    attrs.ContentType,
+		CreationTime: attrs.Created,
+	}, nil
+}
+
 func (s Cloud) Has(ctx context.Context, name string) (bool, error) {
 	_, err := s.Client.Bucket(s.BucketName).Object(name).Attrs(ctx)
 	if err != nil {
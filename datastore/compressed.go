@@ -0,0 +1,108 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/ent/compression"
+	"github.com/google/ent/mediatype"
+	"github.com/google/ent/utils"
+)
+
+// Values stored compressed by Compressed have this suffix appended to their name, so that they can
+// be told apart from values stored before compression was enabled, or not worth compressing.
+const compressedSuffix = ".zst"
+
+// Compressed is a DataStore that stores values compressed with zstd in its inner DataStore, if they
+// are compressible enough. Callers always see the uncompressed values.
+//
+// If the inner DataStore implements MediaTypePutter, the media type of the uncompressed value is
+// recorded for compressed values; if it implements RangeGetter, the size of compressed values is
+// read from their frame header without fetching them in full.
+type Compressed struct {
+	Inner DataStore
+}
+
+func (s Compressed) Get(ctx context.Context, name string) ([]byte, error) {
+	b, err := s.Inner.Get(ctx, name+compressedSuffix)
+	if errors.Is(err, ErrNotFound) {
+		return s.Inner.Get(ctx, name)
+	} else if err != nil {
+		return nil, err
+	}
+	v, err := compression.Decompress(b)
+	if err != nil {
+		return nil, fmt.Errorf("could not decompress %q: %w", name, err)
+	}
+	return v, nil
+}
+
+func (s Compressed) Put(ctx context.Context, name string, value []byte) error {
+	b, ok := compression.CompressIfWorthwhile(value)
+	if !ok {
+		return s.Inner.Put(ctx, name, value)
+	}
+	if p, ok := s.Inner.(MediaTypePutter); ok {
+		return p.PutWithMediaType(ctx, name+compressedSuffix, b, mediatype.Detect("", "", value))
+	}
+	return s.Inner.Put(ctx, name+compressedSuffix, b)
+}
+
+// GetMetadata returns the size of the uncompressed value, and the media type recorded by the inner
+// DataStore.
+func (s Compressed) GetMetadata(ctx context.Context, name string) (utils.Metadata, error) {
+	m, err := s.Inner.GetMetadata(ctx, name+compressedSuffix)
+	if errors.Is(err, ErrNotFound) {
+		return s.Inner.GetMetadata(ctx, name)
+	} else if err != nil {
+		return utils.Metadata{}, err
+	}
+	if r, ok := s.Inner.(RangeGetter); ok {
+		header, err := r.GetRange(ctx, name+compressedSuffix, 0, compression.HeaderMaxSize)
+		if err != nil {
+			return utils.Metadata{}, err
+		}
+		if size, ok := compression.DecompressedSize(header); ok {
+			m.Size = size
+			return m, nil
+		}
+	}
+	b, err := s.Inner.Get(ctx, name+compressedSuffix)
+	if err != nil {
+		return utils.Metadata{}, err
+	}
+	size, ok := compression.DecompressedSize(b)
+	if !ok {
+		v, err := compression.Decompress(b)
+		if err != nil {
+			return utils.Metadata{}, fmt.Errorf("could not decompress %q: %w", name, err)
+		}
+		size = uint64(len(v))
+	}
+	m.Size = size
+	return m, nil
+}
+
+func (s Compressed) Has(ctx context.Context, name string) (bool, error) {
+	ok, err := s.Inner.Has(ctx, name+compressedSuffix)
+	if err != nil || ok {
+		return ok, err
+	}
+	return s.Inner.Has(ctx, name)
+}
@@ -0,0 +1,138 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/ent/mediatype"
+	"github.com/google/ent/utils"
+)
+
+func TestCompressed(t *testing.T) {
+	ctx := context.Background()
+	inner := InMemory{Inner: map[string][]byte{}}
+	s := Compressed{Inner: inner}
+
+	text := bytes.Repeat([]byte("hello world\n"), 1000)
+	short := []byte("hello")
+	inner.Inner["legacy"] = text
+	for name, value := range map[string][]byte{"text": text, "short": short} {
+		if err := s.Put(ctx, name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := inner.Inner["text"+compressedSuffix]; !ok {
+		t.Fatalf("expected text to be stored compressed")
+	}
+	if _, ok := inner.Inner["short"]; !ok {
+		t.Fatalf("expected short value to be stored uncompressed")
+	}
+
+	for name, want := range map[string][]byte{"text": text, "short": short, "legacy": text} {
+		got, err := s.Get(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("Get(%q) mismatch", name)
+		}
+		m, err := s.GetMetadata(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Size != uint64(len(want)) {
+			t.Fatalf("GetMetadata(%q).Size = %d, want %d", name, m.Size, len(want))
+		}
+		if ok, err := s.Has(ctx, name); err != nil || !ok {
+			t.Fatalf("Has(%q) = %v, %v", name, ok, err)
+		}
+	}
+	if ok, err := s.Has(ctx, "missing"); err != nil || ok {
+		t.Fatalf("Has(missing) = %v, %v", ok, err)
+	}
+}
+
+// recordingStore is an in-memory DataStore that records media types, counts full reads, and fails
+// all reads with err if set.
+type recordingStore struct {
+	InMemory
+	mediaTypes map[string]string
+	gets       int
+	err        error
+}
+
+func (s *recordingStore) Get(ctx context.Context, name string) ([]byte, error) {
+	s.gets++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.InMemory.Get(ctx, name)
+}
+
+func (s *recordingStore) GetMetadata(ctx context.Context, name string) (utils.Metadata, error) {
+	if s.err != nil {
+		return utils.Metadata{}, s.err
+	}
+	m, err := s.InMemory.GetMetadata(ctx, name)
+	m.MediaType = s.mediaTypes[name]
+	return m, err
+}
+
+func (s *recordingStore) PutWithMediaType(ctx context.Context, name string, value []byte, mediaType string) error {
+	s.mediaTypes[name] = mediaType
+	return s.InMemory.Put(ctx, name, value)
+}
+
+func TestCompressedMetadata(t *testing.T) {
+	ctx := context.Background()
+	inner := &recordingStore{
+		InMemory:   InMemory{Inner: map[string][]byte{}},
+		mediaTypes: map[string]string{},
+	}
+	s := Compressed{Inner: inner}
+
+	text := bytes.Repeat([]byte("hello world\n"), 1000)
+	if err := s.Put(ctx, "text", text); err != nil {
+		t.Fatal(err)
+	}
+	m, err := s.GetMetadata(ctx, "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Size != uint64(len(text)) {
+		t.Errorf("GetMetadata(text).Size = %d, want %d", m.Size, len(text))
+	}
+	if want := mediatype.Detect("", "", text); m.MediaType != want {
+		t.Errorf("GetMetadata(text).MediaType = %q, want %q", m.MediaType, want)
+	}
+	if inner.gets != 0 {
+		t.Errorf("GetMetadata(text) read the whole value %d times", inner.gets)
+	}
+
+	// Only values that do not exist compressed are looked up under their plain name.
+	inner.Inner["legacy"] = text
+	inner.err = errors.New("unavailable")
+	if _, err := s.Get(ctx, "legacy"); err != inner.err {
+		t.Errorf("Get(legacy) = %v, want %v", err, inner.err)
+	}
+	if _, err := s.GetMetadata(ctx, "legacy"); err != inner.err {
+		t.Errorf("GetMetadata(legacy) = %v, want %v", err, inner.err)
+	}
+}
@@ -17,6 +17,13 @@ package datastore
 
 import (
 	"context"
+	"fmt"
+
+	"github.com/google/ent/utils"
+)
+
+var (
+	ErrNotFound = fmt.Errorf("not found")
 )
 
 // DataStore is an interface defining low-level operations for handling unstructured key/value
@@ -24,6 +31,20 @@ import (
 type DataStore interface {
 	Get(ctx context.Context, name string) ([]byte, error)
 	Put(ctx context.Context, name string, value []byte) error
-	// TODO: return size
+	// GetMetadata returns the size of the value, and its media type and creation time if known, or
+	// ErrNotFound if there is no value with the given name.
+	GetMetadata(ctx context.Context, name string) (utils.Metadata, error)
 	Has(ctx context.Context, name string) (bool, error)
 }
+
+// RangeGetter is implemented by DataStores that can read part of a value without fetching all of
+// it. Reads past the end of the value return the bytes up to the end.
+type RangeGetter interface {
+	GetRange(ctx context.Context, name string, offset int64, length int64) ([]byte, error)
+}
+
+// MediaTypePutter is implemented by DataStores that record the media type of values, so that
+// DataStores that transform values before storing them can record that of the original value.
+type MediaTypePutter interface {
+	PutWithMediaType(ctx context.Context, name string, value []byte, mediaType string) error
+}
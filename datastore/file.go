@@ -17,9 +17,12 @@ package datastore
 
 import (
 	"context"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
+
+	"github.com/google/ent/utils"
 )
 
 // File is an implementation of DataStore using the local file system, rooted at the
@@ -29,13 +32,48 @@ type File struct {
 }
 
 func (s File) Get(ctx context.Context, name string) ([]byte, error) {
-	return ioutil.ReadFile(path.Join(s.DirName, name))
+	b, err := ioutil.ReadFile(path.Join(s.DirName, name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return b, err
+}
+
+func (s File) GetRange(ctx context.Context, name string, offset int64, length int64) ([]byte, error) {
+	f, err := os.Open(path.Join(s.DirName, name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b := make([]byte, length)
+	n, err := f.ReadAt(b, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return b[:n], nil
 }
 
 func (s File) Put(ctx context.Context, name string, value []byte) error {
 	return ioutil.WriteFile(path.Join(s.DirName, name), value, 0644)
 }
 
+// GetMetadata uses the modification time of the file as creation time, since objects are never
+// modified once written.
+func (s File) GetMetadata(ctx context.Context, name string) (utils.Metadata, error) {
+	info, err := os.Stat(path.Join(s.DirName, name))
+	if os.IsNotExist(err) {
+		return utils.Metadata{}, ErrNotFound
+	} else if err != nil {
+		return utils.Metadata{}, err
+	}
+	return utils.Metadata{
+		Size:         uint64(info.Size()),
+		CreationTime: info.ModTime(),
+	}, nil
+}
+
 func (s File) Has(ctx context.Context, name string) (bool, error) {
 	_, err := os.Stat(path.Join(s.DirName, name))
 	if err != nil {
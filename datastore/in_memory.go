@@ -2,7 +2,8 @@ package datastore
 
 import (
 	"context"
-	"fmt"
+
+	"github.com/google/ent/utils"
 )
 
 type InMemory struct {
@@ -14,8 +15,23 @@ func (s InMemory) Get(ctx context.Context, name string) ([]byte, error) {
 	if ok {
 		return b, nil
 	} else {
-		return nil, fmt.Errorf("not found")
+		return nil, ErrNotFound
+	}
+}
+
+func (s InMemory) GetRange(ctx context.Context, name string, offset int64, length int64) ([]byte, error) {
+	b, ok := s.Inner[name]
+	if !ok {
+		return nil, ErrNotFound
 	}
+	if offset > int64(len(b)) {
+		return nil, nil
+	}
+	b = b[offset:]
+	if length < int64(len(b)) {
+		b = b[:length]
+	}
+	return b, nil
 }
 
 func (s InMemory) Put(ctx context.Context, name string, value []byte) error {
@@ -23,6 +39,16 @@ func (s InMemory) Put(ctx context.Context, name string, value []byte) error {
 	return nil
 }
 
+func (s InMemory) GetMetadata(ctx context.Context, name string) (utils.Metadata, error) {
+	v, ok := s.Inner[name]
+	if !ok {
+		return utils.Metadata{}, ErrNotFound
+	}
+	return utils.Metadata{
+		Size: uint64(len(v)),
+	}, nil
+}
+
 func (s InMemory) Has(ctx context.Context, name string) (bool, error) {
 	_, ok := s.Inner[name]
 	return ok, nil
@@ -5,6 +5,7 @@ import (
 
 	"github.com/go-redis/redis/v8"
 	"github.com/google/ent/log"
+	"github.com/google/ent/utils"
 )
 
 type Memcache struct {
@@ -39,6 +40,10 @@ func (s Memcache) Put(ctx context.Context, name string, value []byte) error {
 	return nil
 }
 
+func (s Memcache) GetMetadata(ctx context.Context, name string) (utils.Metadata, error) {
+	return s.Inner.GetMetadata(ctx, name)
+}
+
 func (s Memcache) Has(ctx context.Context, name string) (bool, error) {
 	return s.Inner.Has(ctx, name)
 }
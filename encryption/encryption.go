@@ -0,0 +1,247 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package encryption encrypts objects on the client, so that they can be stored on remotes whose
+// operators are not trusted with their contents.
+//
+// Each object is encrypted with AES-256-GCM under its own key, and stored as a regular raw object.
+// Its key is embedded, together with the digest of the ciphertext, in the link that refers to it,
+// so encrypted directories are DAG nodes whose links are themselves keys to their children, and
+// the link to the root of a tree is all that is needed to read it back. Such links must therefore
+// be treated as secrets.
+//
+// In convergent mode, the key of an object is derived from its contents and a secret, so that
+// identical objects encrypted with the same secret dedupe, at the cost of revealing to the remote
+// that they are identical. In random mode, each object gets a fresh random key.
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/google/ent/nodeservice"
+	"github.com/google/ent/utils"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+type Mode int
+
+const (
+	// Keys are derived from the contents of objects and the secret.
+	Convergent Mode = iota
+	// Keys are random.
+	Random
+)
+
+func ParseMode(s string) (Mode, error) {
+	switch s {
+	case "", "convergent":
+		return Convergent, nil
+	case "random":
+		return Random, nil
+	default:
+		return Convergent, fmt.Errorf("invalid encryption mode: %q", s)
+	}
+}
+
+const (
+	keySize = 32
+	// Overhead is the number of bytes that encryption adds to an object.
+	Overhead = 16
+)
+
+// Every key encrypts a single plaintext, so the nonce can be fixed.
+var nonce = make([]byte, 12)
+
+// SecretFromKey derives the secret used for convergent encryption from a secret key, as configured
+// in the CLI. Only P-256 keys, as generated by ent keygen, are supported.
+func SecretFromKey(k *ecdsa.PrivateKey) ([]byte, error) {
+	if k.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("unsupported curve %s, must be P-256", k.Curve.Params().Name)
+	}
+	mac := hmac.New(sha256.New, k.D.FillBytes(make([]byte, keySize)))
+	mac.Write([]byte("ent convergent encryption"))
+	return mac.Sum(nil), nil
+}
+
+// Ref is the parsed form of a link to an encrypted object.
+type Ref struct {
+	// Type of the plaintext, either utils.TypeRaw or utils.TypeDAG.
+	Type uint64
+	// Digest of the ciphertext, under which it is stored.
+	Digest utils.Digest
+	Key    []byte
+}
+
+// IsLink returns whether link refers to an encrypted object.
+func IsLink(link cid.Cid) bool {
+	switch link.Type() {
+	case utils.TypeEncryptedRaw, utils.TypeEncryptedDAG:
+		return true
+	default:
+		return false
+	}
+}
+
+// Link returns the link to the encrypted object, which embeds its key in an identity multihash.
+func (r Ref) Link() (cid.Cid, error) {
+	var t uint64
+	switch r.Type {
+	case utils.TypeRaw:
+		t = utils.TypeEncryptedRaw
+	case utils.TypeDAG:
+		t = utils.TypeEncryptedDAG
+	default:
+		return cid.Cid{}, fmt.Errorf("unknown type: %v", r.Type)
+	}
+	b := append(append([]byte{}, r.Digest...), r.Key...)
+	h, err := multihash.Sum(b, multihash.IDENTITY, -1)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	return cid.NewCidV1(t, h), nil
+}
+
+func ParseLink(link cid.Cid) (Ref, error) {
+	r := Ref{}
+	switch link.Type() {
+	case utils.TypeEncryptedRaw:
+		r.Type = utils.TypeRaw
+	case utils.TypeEncryptedDAG:
+		r.Type = utils.TypeDAG
+	default:
+		return Ref{}, fmt.Errorf("not an encrypted link: %v", link)
+	}
+	h, err := multihash.Decode(link.Hash())
+	if err != nil {
+		return Ref{}, fmt.Errorf("invalid multihash: %w", err)
+	}
+	if h.Code != multihash.IDENTITY {
+		return Ref{}, fmt.Errorf("invalid multihash code: %v", h.Code)
+	}
+	n, digest, err := multihash.MHFromBytes(h.Digest)
+	if err != nil {
+		return Ref{}, fmt.Errorf("invalid digest: %w", err)
+	}
+	if len(h.Digest)-n != keySize {
+		return Ref{}, fmt.Errorf("invalid key size: %d", len(h.Digest)-n)
+	}
+	r.Digest = utils.Digest(digest)
+	r.Key = h.Digest[n:]
+	return r, nil
+}
+
+// Store encrypts objects before putting them in Inner, and decrypts them after getting them.
+type Store struct {
+	Inner nodeservice.ObjectStore
+	Mode  Mode
+	// Only used in convergent mode.
+	Secret []byte
+}
+
+// Seal encrypts b, which is an object of type t, and returns the ciphertext and the link to it.
+func (s Store) Seal(b []byte, t uint64) ([]byte, cid.Cid, error) {
+	key := make([]byte, keySize)
+	switch s.Mode {
+	case Convergent:
+		if len(s.Secret) == 0 {
+			return nil, cid.Cid{}, fmt.Errorf("convergent encryption requires a secret")
+		}
+		mac := hmac.New(sha256.New, s.Secret)
+		mac.Write(b)
+		key = mac.Sum(nil)
+	case Random:
+		if _, err := rand.Read(key); err != nil {
+			return nil, cid.Cid{}, fmt.Errorf("could not generate key: %w", err)
+		}
+	default:
+		return nil, cid.Cid{}, fmt.Errorf("unknown mode: %v", s.Mode)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, cid.Cid{}, err
+	}
+	ciphertext := aead.Seal(nil, nonce, b, nil)
+	link, err := Ref{
+		Type:   t,
+		Digest: utils.ComputeDigest(ciphertext),
+		Key:    key,
+	}.Link()
+	if err != nil {
+		return nil, cid.Cid{}, err
+	}
+	return ciphertext, link, nil
+}
+
+func (s Store) Put(ctx context.Context, b []byte, t uint64) (cid.Cid, error) {
+	ciphertext, link, err := s.Seal(b, t)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	if _, err := s.Inner.Put(ctx, ciphertext); err != nil {
+		return cid.Cid{}, err
+	}
+	return link, nil
+}
+
+func (s Store) Get(ctx context.Context, link cid.Cid) ([]byte, error) {
+	return Get(ctx, s.Inner, link)
+}
+
+// Get fetches the encrypted object referred to by link from o, and decrypts it.
+func Get(ctx context.Context, o nodeservice.ObjectGetter, link cid.Cid) ([]byte, error) {
+	r, err := ParseLink(link)
+	if err != nil {
+		return nil, err
+	}
+	b, err := o.Get(ctx, r.Digest)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(utils.ComputeDigest(b), r.Digest) {
+		return nil, fmt.Errorf("digest mismatch")
+	}
+	return Open(b, r)
+}
+
+// Open decrypts the ciphertext of the object referred to by r.
+func Open(b []byte, r Ref) ([]byte, error) {
+	aead, err := newAEAD(r.Key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, nonce, b, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
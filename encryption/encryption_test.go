@@ -0,0 +1,175 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/google/ent/datastore"
+	"github.com/google/ent/objectstore"
+	"github.com/google/ent/utils"
+	"github.com/ipfs/go-cid"
+)
+
+func newStore(t *testing.T, mode Mode) Store {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := SecretFromKey(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Store{
+		Inner: objectstore.Store{
+			Inner: datastore.InMemory{
+				Inner: make(map[string][]byte),
+			},
+		},
+		Mode:   mode,
+		Secret: secret,
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	for _, mode := range []Mode{Convergent, Random} {
+		s := newStore(t, mode)
+		plaintext := []byte("hello world")
+		link, err := s.Put(ctx, plaintext, utils.TypeRaw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if link.Type() != utils.TypeEncryptedRaw {
+			t.Fatalf("unexpected link type: %x", link.Type())
+		}
+		r, err := ParseLink(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ciphertext, err := s.Inner.Get(ctx, r.Digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(ciphertext, plaintext) {
+			t.Fatalf("plaintext stored in the clear")
+		}
+		got, err := s.Get(ctx, link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Fatalf("Get() = %q, want %q", got, plaintext)
+		}
+
+		// Round trip through the string representation, as printed by the CLI.
+		parsed, err := cid.Decode(link.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !parsed.Equals(link) {
+			t.Fatalf("link mismatch after parsing")
+		}
+	}
+}
+
+func TestConvergent(t *testing.T) {
+	s := newStore(t, Convergent)
+	plaintext := []byte("hello world")
+	c1, l1, err := s.Seal(plaintext, utils.TypeRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, l2, err := s.Seal(plaintext, utils.TypeRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(c1, c2) || !l1.Equals(l2) {
+		t.Fatalf("convergent encryption is not deterministic")
+	}
+
+	// Different secrets must not dedupe.
+	other := newStore(t, Convergent)
+	c3, _, err := other.Seal(plaintext, utils.TypeRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(c1, c3) {
+		t.Fatalf("different secrets produced the same ciphertext")
+	}
+}
+
+func TestRandom(t *testing.T) {
+	s := newStore(t, Random)
+	plaintext := []byte("hello world")
+	c1, _, err := s.Seal(plaintext, utils.TypeRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, _, err := s.Seal(plaintext, utils.TypeRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(c1, c2) {
+		t.Fatalf("random encryption is deterministic")
+	}
+}
+
+func TestTamper(t *testing.T) {
+	s := newStore(t, Random)
+	ciphertext, link, err := s.Seal([]byte("hello world"), utils.TypeDAG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := ParseLink(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Type != utils.TypeDAG {
+		t.Fatalf("unexpected type: %x", r.Type)
+	}
+	ciphertext[0] ^= 1
+	if _, err := Open(ciphertext, r); err == nil {
+		t.Fatalf("expected tampered ciphertext to fail to decrypt")
+	}
+}
+
+func TestParseLinkNotEncrypted(t *testing.T) {
+	link := cid.NewCidV1(utils.TypeRaw, []byte(utils.ComputeDigest([]byte("hello"))))
+	if IsLink(link) {
+		t.Fatalf("IsLink(%v) = true", link)
+	}
+	if _, err := ParseLink(link); err == nil {
+		t.Fatalf("expected error parsing %v", link)
+	}
+}
+
+func TestSecretFromKey(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P224(), elliptic.P384(), elliptic.P521()} {
+		k, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := SecretFromKey(k); err == nil {
+			t.Errorf("SecretFromKey(%s key) succeeded, want error", curve.Params().Name)
+		}
+	}
+}
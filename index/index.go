@@ -16,6 +16,10 @@
 package index
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/google/ent/utils"
@@ -31,6 +35,16 @@ type IndexEntry struct {
 	Digest    string   `json:"digest"`
 	Size      int      `json:"size"`
 	URLS      []string `json:"urls"`
+	// Result of the last verification of each URL, keyed by URL.
+	Status map[string]URLStatus `json:"status,omitempty"`
+	// URLs removed from URLS because they no longer serve the expected content.
+	Quarantined []string `json:"quarantined,omitempty"`
+}
+
+// Directory names used for the digest prefix, matching the layout of the published index.
+var pathPrefixes = map[string]string{
+	"sha2-256": "sha256",
+	"sha2-512": "sha512",
 }
 
 // Split the digest into its prefix, and then two character chunks, separated by slashes, so that
@@ -38,8 +52,35 @@ type IndexEntry struct {
 func DigestToPath(digest utils.Digest) string {
 	s := strings.Split(utils.DigestToHumanString(digest), ":")
 	out := s[0]
+	if prefix, ok := pathPrefixes[out]; ok {
+		out = prefix
+	}
 	for i := 0; i < len(s[1])/2; i++ {
 		out += "/" + s[1][i*2:(i+1)*2]
 	}
 	return out
 }
+
+// PathToDigest is the inverse of DigestToPath.
+func PathToDigest(p string) (utils.Digest, error) {
+	parts := strings.Split(filepath.ToSlash(p), "/")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid index path: %q", p)
+	}
+	return utils.ParseDigest(parts[0] + ":" + strings.Join(parts[1:], ""))
+}
+
+// ReadEntry reads the entry for the given digest from the index rooted at dir. If the index does
+// not contain the digest, the returned error satisfies os.IsNotExist.
+func ReadEntry(dir string, digest utils.Digest) (*IndexEntry, error) {
+	b, err := os.ReadFile(filepath.Join(dir, DigestToPath(digest), EntryFilename))
+	if err != nil {
+		return nil, err
+	}
+	var e IndexEntry
+	err = json.Unmarshal(b, &e)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal JSON for index entry: %w", err)
+	}
+	return &e, nil
+}
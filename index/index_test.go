@@ -16,6 +16,9 @@
 package index
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/go-playground/assert/v2"
@@ -29,3 +32,43 @@ func TestDigestToPath(t *testing.T) {
 	}
 	assert.Equal(t, "sha256/36/6a/c3/bd/ad/37/d1/bd/c0/ca/87/e2/ea/60/11/18/72/e2/c8/d7/aa/c8/a1/8f/25/88/d7/91/05/6e/65/8f", DigestToPath(digest))
 }
+
+func TestAdd(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte("hello")
+	for _, u := range []string{"https://b.example/x", "https://a.example/x", "https://b.example/x"} {
+		_, err := Add(dir, data, "", u)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	e, err := ReadEntry(dir, utils.ComputeDigest(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"https://a.example/x", "https://b.example/x"}, e.URLS)
+	assert.Equal(t, len(data), e.Size)
+}
+
+func TestPathToDigest(t *testing.T) {
+	digest := utils.ComputeDigest([]byte("hello"))
+	got, err := PathToDigest(DigestToPath(digest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, digest, got)
+}
+
+func TestFetchPublicOnly(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	if _, _, _, err := Fetch(context.Background(), server.URL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, _, _, err := FetchWithClient(context.Background(), PublicClient, server.URL); err == nil {
+		t.Fatalf("expected PublicClient to refuse to fetch from %q", server.URL)
+	}
+}
@@ -0,0 +1,171 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/ent/utils"
+)
+
+// The packed layout is an alternative to one file per digest, which is faster to clone and to
+// walk for large indexes. Entries are grouped by a prefix of their digest into shards, each of
+// which is a JSON array of entries sorted by digest, and is stored as an object named after its own
+// digest. A small manifest lists the shards sorted by prefix, so that clients can find the entry for
+// a digest with two requests and a binary search in each.
+
+const (
+	PackedDir        = "packed"
+	ManifestFilename = "manifest.json"
+	ObjectsDir       = "objects"
+)
+
+type Manifest struct {
+	// Number of hex characters of the digest used to group entries into shards.
+	PrefixLength int     `json:"prefixLength"`
+	Shards       []Shard `json:"shards"`
+}
+
+type Shard struct {
+	// The algorithm name and the first PrefixLength hex characters of the digests of the entries.
+	Prefix string `json:"prefix"`
+	// Digest of the shard contents; see utils.ParseDigest.
+	Digest string `json:"digest"`
+	Count  int    `json:"count"`
+}
+
+// ShardPrefix returns the prefix of the shard that the entry for digest belongs to.
+func ShardPrefix(digest utils.Digest, prefixLength int) string {
+	h := utils.DigestToHumanString(digest)
+	n := strings.Index(h, ":") + 1 + prefixLength
+	if n > len(h) {
+		n = len(h)
+	}
+	return h[:n]
+}
+
+// Find returns the shard that would contain the entry for digest, if any.
+func (m *Manifest) Find(digest utils.Digest) (Shard, bool) {
+	prefix := ShardPrefix(digest, m.PrefixLength)
+	i := sort.Search(len(m.Shards), func(i int) bool {
+		return m.Shards[i].Prefix >= prefix
+	})
+	if i < len(m.Shards) && m.Shards[i].Prefix == prefix {
+		return m.Shards[i], true
+	}
+	return Shard{}, false
+}
+
+// FindEntry returns the entry for digest from the given shard contents, or nil if there is none.
+func FindEntry(shard []byte, digest utils.Digest) (*IndexEntry, error) {
+	entries := []IndexEntry{}
+	err := json.Unmarshal(shard, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal JSON for shard: %w", err)
+	}
+	key := utils.DigestToHumanString(digest)
+	i := sort.Search(len(entries), func(i int) bool {
+		return entries[i].Digest >= key
+	})
+	if i < len(entries) && entries[i].Digest == key {
+		return &entries[i], nil
+	}
+	return nil, nil
+}
+
+// Pack writes the packed layout of the index rooted at dir under its PackedDir subdirectory, and
+// returns the manifest and the contents of the shards. Objects of previous packs are left in place,
+// so that clients holding an older manifest keep working.
+func Pack(dir string, prefixLength int) (*Manifest, [][]byte, error) {
+	groups := map[string][]IndexEntry{}
+	err := Walk(dir, func(digest utils.Digest, e *IndexEntry) error {
+		// Derive the digest from the path, in case the field is missing or malformed.
+		e.Digest = utils.DigestToHumanString(digest)
+		prefix := ShardPrefix(digest, prefixLength)
+		groups[prefix] = append(groups[prefix], *e)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	objectsDir := filepath.Join(dir, PackedDir, ObjectsDir)
+	err = os.MkdirAll(objectsDir, 0755)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create directory: %w", err)
+	}
+	m := &Manifest{
+		PrefixLength: prefixLength,
+		Shards:       []Shard{},
+	}
+	shards := [][]byte{}
+	for prefix, entries := range groups {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Digest < entries[j].Digest
+		})
+		b, err := json.Marshal(entries)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not marshal JSON: %w", err)
+		}
+		digest := utils.ComputeDigest(b)
+		err = os.WriteFile(filepath.Join(objectsDir, digest.String()), b, 0644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not write shard: %w", err)
+		}
+		m.Shards = append(m.Shards, Shard{
+			Prefix: prefix,
+			Digest: digest.String(),
+			Count:  len(entries),
+		})
+		shards = append(shards, b)
+	}
+	sort.Slice(m.Shards, func(i, j int) bool {
+		return m.Shards[i].Prefix < m.Shards[j].Prefix
+	})
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not marshal JSON: %w", err)
+	}
+	packedDir := filepath.Join(dir, PackedDir)
+	err = os.WriteFile(filepath.Join(packedDir, ManifestFilename), b, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not write manifest: %w", err)
+	}
+	err = os.Remove(filepath.Join(packedDir, ManifestFilename+".sig"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("could not remove stale signatures: %w", err)
+	}
+	return m, shards, nil
+}
+
+// VerifyShard checks that b matches the digest of the shard.
+func VerifyShard(s Shard, b []byte) error {
+	digest, err := utils.ParseDigest(s.Digest)
+	if err != nil {
+		return fmt.Errorf("invalid shard digest %q: %w", s.Digest, err)
+	}
+	if !bytes.Equal(utils.ComputeDigest(b), digest) {
+		return fmt.Errorf("mismatching digest for shard %q", s.Prefix)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/google/ent/utils"
+)
+
+func TestPack(t *testing.T) {
+	dir := t.TempDir()
+	digests := []utils.Digest{}
+	for i := 0; i < 50; i++ {
+		data := []byte(fmt.Sprintf("object %d", i))
+		_, err := Add(dir, data, "", fmt.Sprintf("https://example.com/%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		digests = append(digests, utils.ComputeDigest(data))
+	}
+	m, shards, err := Pack(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(m.Shards), len(shards))
+
+	b, err := os.ReadFile(filepath.Join(dir, PackedDir, ManifestFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := Manifest{}
+	if err := json.Unmarshal(b, &read); err != nil {
+		t.Fatal(err)
+	}
+	for i, digest := range digests {
+		shard, ok := read.Find(digest)
+		if !ok {
+			t.Fatalf("no shard for object %d", i)
+		}
+		sb, err := os.ReadFile(filepath.Join(dir, PackedDir, ObjectsDir, shard.Digest))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyShard(shard, sb); err != nil {
+			t.Fatal(err)
+		}
+		e, err := FindEntry(sb, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e == nil {
+			t.Fatalf("no entry for object %d", i)
+		}
+		assert.Equal(t, []string{fmt.Sprintf("https://example.com/%d", i)}, e.URLS)
+	}
+
+	missing := utils.ComputeDigest([]byte("missing"))
+	if shard, ok := read.Find(missing); ok {
+		sb, err := os.ReadFile(filepath.Join(dir, PackedDir, ObjectsDir, shard.Digest))
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, err := FindEntry(sb, missing)
+		if err != nil || e != nil {
+			t.Fatalf("FindEntry(missing) = %v, %v", e, err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/ent/utils"
+)
+
+const (
+	// Detached signatures over the exact bytes of the entry file, stored next to it.
+	SignatureFilename = EntryFilename + ".sig"
+)
+
+type Signature struct {
+	// As formatted by utils.FormatPublicKey.
+	PublicKey string `json:"publicKey"`
+	// URL-safe base64 of the ASN.1 ECDSA signature of the SHA-256 digest of the entry.
+	Signature string `json:"signature"`
+}
+
+func Sign(b []byte, key *ecdsa.PrivateKey) (Signature, error) {
+	h := sha256.Sum256(b)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, h[:])
+	if err != nil {
+		return Signature{}, fmt.Errorf("could not sign entry: %w", err)
+	}
+	pk, err := utils.FormatPublicKey(&key.PublicKey)
+	if err != nil {
+		return Signature{}, err
+	}
+	return Signature{
+		PublicKey: pk,
+		Signature: base64.URLEncoding.EncodeToString(sig),
+	}, nil
+}
+
+// VerifySignatures returns nil if at least one of sigs is a valid signature of b made with one of
+// the trusted keys.
+func VerifySignatures(b []byte, sigs []Signature, trusted []*ecdsa.PublicKey) error {
+	h := sha256.Sum256(b)
+	for _, s := range sigs {
+		pk, err := utils.ParsePublicKey(s.PublicKey)
+		if err != nil {
+			continue
+		}
+		if !isTrusted(pk, trusted) {
+			continue
+		}
+		sig, err := base64.URLEncoding.DecodeString(s.Signature)
+		if err != nil {
+			continue
+		}
+		if ecdsa.VerifyASN1(pk, h[:], sig) {
+			return nil
+		}
+	}
+	return fmt.Errorf("no valid signature from a trusted key among %d signatures", len(sigs))
+}
+
+func isTrusted(pk *ecdsa.PublicKey, trusted []*ecdsa.PublicKey) bool {
+	for _, t := range trusted {
+		if pk.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// SignEntry adds a signature made with key to the entry for the given digest in the index rooted
+// at dir, replacing any previous signature made with the same key.
+func SignEntry(dir string, digest utils.Digest, key *ecdsa.PrivateKey) error {
+	return SignFile(filepath.Join(dir, DigestToPath(digest), EntryFilename), key)
+}
+
+// SignManifest adds a signature made with key to the manifest of the packed layout of the index
+// rooted at dir.
+func SignManifest(dir string, key *ecdsa.PrivateKey) error {
+	return SignFile(filepath.Join(dir, PackedDir, ManifestFilename), key)
+}
+
+// SignFile adds a signature of the file at p made with key to the detached signatures stored in
+// p + ".sig", replacing any previous signature made with the same key.
+func SignFile(p string, key *ecdsa.PrivateKey) error {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	sig, err := Sign(b, key)
+	if err != nil {
+		return err
+	}
+	sigs, err := readSignatures(p)
+	if err != nil {
+		return err
+	}
+	out := []Signature{sig}
+	for _, s := range sigs {
+		if s.PublicKey != sig.PublicKey {
+			out = append(out, s)
+		}
+	}
+	ss, err := json.Marshal(out)
+	if err != nil {
+		return fmt.Errorf("could not marshal JSON: %w", err)
+	}
+	return os.WriteFile(p+".sig", ss, 0644)
+}
+
+// ReadSignatures returns the signatures of the entry for the given digest in the index rooted at
+// dir, which are empty if the entry is not signed.
+func ReadSignatures(dir string, digest utils.Digest) ([]Signature, error) {
+	return readSignatures(filepath.Join(dir, DigestToPath(digest), EntryFilename))
+}
+
+// readSignatures returns the detached signatures of the file at p.
+func readSignatures(p string) ([]Signature, error) {
+	sigs := []Signature{}
+	b, err := os.ReadFile(p + ".sig")
+	if os.IsNotExist(err) {
+		return sigs, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, &sigs)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal JSON for signatures: %w", err)
+	}
+	return sigs, nil
+}
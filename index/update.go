@@ -0,0 +1,169 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/google/ent/mediatype"
+	"github.com/google/ent/utils"
+)
+
+// MaxFetchSize is the largest object that Fetch downloads.
+const MaxFetchSize = 1 << 30
+
+// PublicClient is an HTTP client that refuses to connect to loopback, private, link-local and other
+// non-public addresses, for fetching URLs supplied by untrusted callers. The check happens when
+// connecting, after name resolution, so that it cannot be bypassed with DNS.
+var PublicClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 30 * time.Second,
+			Control: publicOnly,
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	Timeout: 10 * time.Minute,
+}
+
+func publicOnly(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("non-public address %q", address)
+	}
+	return nil
+}
+
+// Fetch downloads the object at the given URL, and returns it along with the normalized URL that
+// should be recorded in the index and its detected media type.
+func Fetch(ctx context.Context, urlString string) (string, []byte, string, error) {
+	return FetchWithClient(ctx, http.DefaultClient, urlString)
+}
+
+// FetchWithClient is like Fetch, but uses the given HTTP client.
+func FetchWithClient(ctx context.Context, client *http.Client, urlString string) (string, []byte, string, error) {
+	parsedURL, err := url.Parse(urlString)
+	if err != nil {
+		return "", nil, "", fmt.Errorf("invalid URL: %w", err)
+	}
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return "", nil, "", fmt.Errorf("unsupported URL scheme %q", parsedURL.Scheme)
+	}
+	if parsedURL.User != nil {
+		return "", nil, "", fmt.Errorf("non-empty user in URL")
+	}
+	if parsedURL.Fragment != "" {
+		return "", nil, "", fmt.Errorf("non-empty fragment in URL")
+	}
+	urlString = parsedURL.String()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlString, nil)
+	if err != nil {
+		return "", nil, "", fmt.Errorf("could not create request: %w", err)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", nil, "", fmt.Errorf("could not fetch URL %q: %w", urlString, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", nil, "", fmt.Errorf("invalid error code %d (%s)", res.StatusCode, res.Status)
+	}
+	if res.ContentLength > MaxFetchSize {
+		return "", nil, "", fmt.Errorf("object too large: %d bytes", res.ContentLength)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, MaxFetchSize+1))
+	if err != nil {
+		return "", nil, "", fmt.Errorf("could not read HTTP body: %w", err)
+	}
+	if len(data) > MaxFetchSize {
+		return "", nil, "", fmt.Errorf("object larger than %d bytes", MaxFetchSize)
+	}
+	return urlString, data, mediatype.Detect(urlString, res.Header.Get("Content-Type"), data), nil
+}
+
+// Add records that data may be found at each of the given URLs in the index rooted at dir, creating
+// the entry if necessary, and returns the updated entry. If mediaType is empty, the media type
+// already in the entry is kept, or detected from data if there is none.
+func Add(dir string, data []byte, mediaType string, urls ...string) (*IndexEntry, error) {
+	digest := utils.ComputeDigest(data)
+	e, err := ReadEntry(dir, digest)
+	if os.IsNotExist(err) {
+		e = &IndexEntry{}
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, u := range urls {
+		i := sort.SearchStrings(e.URLS, u)
+		if i == len(e.URLS) || e.URLS[i] != u {
+			e.URLS = append(e.URLS, u)
+			sort.Strings(e.URLS)
+		}
+	}
+	// Fix all fields just in case.
+	if mediaType != "" {
+		e.MediaType = mediaType
+	} else if e.MediaType == "" {
+		e.MediaType = mediatype.Detect("", "", data)
+	}
+	e.Digest = utils.DigestToHumanString(digest)
+	e.Size = len(data)
+
+	err = WriteEntry(dir, digest, e)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// WriteEntry writes the entry for the given digest to the index rooted at dir, replacing any
+// existing one. Existing signatures no longer apply, so they are removed; see SignEntry.
+func WriteEntry(dir string, digest utils.Digest, e *IndexEntry) error {
+	l := filepath.Join(dir, DigestToPath(digest), EntryFilename)
+	es, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("could not marshal JSON: %w", err)
+	}
+	err = os.MkdirAll(filepath.Dir(l), 0755)
+	if err != nil {
+		return fmt.Errorf("could not create directory: %w", err)
+	}
+	err = os.WriteFile(l, es, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write to file: %w", err)
+	}
+	err = os.Remove(filepath.Join(filepath.Dir(l), SignatureFilename))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not remove stale signatures: %w", err)
+	}
+	return nil
+}
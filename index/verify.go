@@ -0,0 +1,123 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/google/ent/utils"
+)
+
+const (
+	StatusOK       = "ok"
+	StatusMismatch = "mismatch"
+	StatusError    = "error"
+)
+
+// URLStatus records the outcome of the last attempt to verify a URL of an index entry.
+type URLStatus struct {
+	LastVerified time.Time `json:"lastVerified"`
+	Status       string    `json:"status"`
+	Error        string    `json:"error,omitempty"`
+	// Number of consecutive verifications that failed with StatusError.
+	Failures int `json:"failures,omitempty"`
+}
+
+type VerifyOptions struct {
+	// Number of consecutive failed fetches after which a URL is considered dead and removed from
+	// the entry. URLs serving different content are always removed immediately.
+	MaxFailures int
+	// If true, bad URLs are dropped entirely instead of being moved to the quarantine list.
+	Remove bool
+}
+
+// Walk calls f for each entry in the index rooted at dir.
+func Walk(dir string, f func(digest utils.Digest, e *IndexEntry) error) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != EntryFilename {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, filepath.Dir(p))
+		if err != nil {
+			return err
+		}
+		digest, err := PathToDigest(rel)
+		if err != nil {
+			return fmt.Errorf("could not parse digest of %q: %w", p, err)
+		}
+		e, err := ReadEntry(dir, digest)
+		if err != nil {
+			return fmt.Errorf("could not read %q: %w", p, err)
+		}
+		return f(digest, e)
+	})
+}
+
+// Verify downloads each URL of the entry, records the outcome in e.Status, and removes the URLs
+// that no longer serve the expected content, returning them. It also reports whether the entry
+// changed other than by the time of each verification, since unchanged entries need not be
+// rewritten, which would invalidate their signatures.
+func Verify(ctx context.Context, digest utils.Digest, e *IndexEntry, opts VerifyOptions) ([]string, bool) {
+	if e.Status == nil {
+		e.Status = map[string]URLStatus{}
+	}
+	kept := []string{}
+	var bad []string
+	changed := false
+	for _, u := range e.URLS {
+		old, ok := e.Status[u]
+		s := old
+		s.LastVerified = time.Now().UTC()
+		s.Error = ""
+		_, data, _, err := Fetch(ctx, u)
+		if err != nil {
+			s.Status = StatusError
+			s.Error = err.Error()
+			s.Failures++
+		} else if !utils.MatchesDigest(data, digest) {
+			s.Status = StatusMismatch
+			s.Failures = 0
+		} else {
+			s.Status = StatusOK
+			s.Failures = 0
+		}
+		if !ok || s.Status != old.Status || s.Error != old.Error || s.Failures != old.Failures {
+			changed = true
+		}
+		e.Status[u] = s
+		if s.Status == StatusMismatch || (s.Status == StatusError && opts.MaxFailures > 0 && s.Failures >= opts.MaxFailures) {
+			bad = append(bad, u)
+		} else {
+			kept = append(kept, u)
+		}
+	}
+	e.URLS = kept
+	if !opts.Remove {
+		e.Quarantined = append(e.Quarantined, bad...)
+	} else {
+		for _, u := range bad {
+			delete(e.Status, u)
+		}
+	}
+	return bad, changed || len(bad) > 0
+}
@@ -0,0 +1,93 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+	"github.com/google/ent/utils"
+	"github.com/multiformats/go-multihash"
+)
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	data := []byte("hello")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	})
+	mux.HandleFunc("/changed", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("changed"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dir := t.TempDir()
+	_, err := Add(dir, data, "", server.URL+"/ok", server.URL+"/changed", server.URL+"/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	err = Walk(dir, func(digest utils.Digest, e *IndexEntry) error {
+		n++
+		assert.Equal(t, utils.ComputeDigest(data), digest)
+		bad, changed := Verify(ctx, digest, e, VerifyOptions{MaxFailures: 2})
+		assert.Equal(t, []string{server.URL + "/changed"}, bad)
+		assert.Equal(t, true, changed)
+		assert.Equal(t, []string{server.URL + "/missing", server.URL + "/ok"}, e.URLS)
+		assert.Equal(t, []string{server.URL + "/changed"}, e.Quarantined)
+		assert.Equal(t, StatusOK, e.Status[server.URL+"/ok"].Status)
+		assert.Equal(t, StatusError, e.Status[server.URL+"/missing"].Status)
+
+		// The second consecutive failure removes the dead URL.
+		bad, _ = Verify(ctx, digest, e, VerifyOptions{MaxFailures: 2, Remove: true})
+		assert.Equal(t, []string{server.URL + "/missing"}, bad)
+		assert.Equal(t, []string{server.URL + "/ok"}, e.URLS)
+
+		// Verifying again only updates the verification times.
+		bad, changed = Verify(ctx, digest, e, VerifyOptions{MaxFailures: 2})
+		assert.Equal(t, 0, len(bad))
+		assert.Equal(t, false, changed)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, n)
+}
+
+func TestVerifySHA512(t *testing.T) {
+	ctx := context.Background()
+	data := []byte("hello")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	digest, err := multihash.Sum(data, multihash.SHA2_512, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &IndexEntry{URLS: []string{server.URL}}
+	bad, _ := Verify(ctx, utils.Digest(digest), e, VerifyOptions{})
+	assert.Equal(t, 0, len(bad))
+	assert.Equal(t, StatusOK, e.Status[server.URL].Status)
+}
@@ -0,0 +1,129 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mediatype determines the media type of objects, combining hints from their name, from the
+// Content-Type header they were originally served with, and from their contents.
+package mediatype
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const (
+	OctetStream = "application/octet-stream"
+)
+
+// Types for common extensions, which take precedence over the system MIME tables, since those vary
+// across platforms and are often incomplete.
+var extensionTypes = map[string]string{
+	".css":         "text/css; charset=utf-8",
+	".csv":         "text/csv; charset=utf-8",
+	".gif":         "image/gif",
+	".htm":         "text/html; charset=utf-8",
+	".html":        "text/html; charset=utf-8",
+	".ico":         "image/vnd.microsoft.icon",
+	".jpeg":        "image/jpeg",
+	".jpg":         "image/jpeg",
+	".js":          "text/javascript; charset=utf-8",
+	".json":        "application/json",
+	".map":         "application/json",
+	".md":          "text/markdown; charset=utf-8",
+	".mjs":         "text/javascript; charset=utf-8",
+	".pdf":         "application/pdf",
+	".png":         "image/png",
+	".svg":         "image/svg+xml",
+	".txt":         "text/plain; charset=utf-8",
+	".wasm":        "application/wasm",
+	".webmanifest": "application/manifest+json",
+	".webp":        "image/webp",
+	".woff":        "font/woff",
+	".woff2":       "font/woff2",
+	".xml":         "text/xml; charset=utf-8",
+	".yaml":        "application/yaml",
+	".yml":         "application/yaml",
+}
+
+// Detect returns the media type of data. name is the file name or URL the object was found at, and
+// contentType is the Content-Type header it was served with; either may be empty.
+//
+// Magic bytes identifying a specific format are trusted first. Otherwise, for text and unknown
+// content, the extension of name is used, then contentType, and finally a best guess based on the
+// contents.
+func Detect(name string, contentType string, data []byte) string {
+	sniffed := http.DetectContentType(data)
+	if !generic(sniffed) {
+		return sniffed
+	}
+	if t := ByName(name); t != "" {
+		return t
+	}
+	if contentType != "" && !generic(contentType) {
+		return contentType
+	}
+	return sniff(sniffed, data)
+}
+
+// ByName returns the media type corresponding to the extension of name, which may be a file name, a
+// path or a URL, or the empty string if unknown.
+func ByName(name string) string {
+	if u, err := url.Parse(name); err == nil && u.Path != "" {
+		name = u.Path
+	}
+	ext := strings.ToLower(path.Ext(name))
+	if ext == "" {
+		return ""
+	}
+	if t, ok := extensionTypes[ext]; ok {
+		return t
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// generic reports whether t does not say anything useful about the format of the content, which is
+// the case for what http.DetectContentType returns for all text formats, and for what many servers
+// use by default.
+func generic(t string) bool {
+	mediaType, _, err := mime.ParseMediaType(t)
+	if err != nil {
+		return true
+	}
+	switch mediaType {
+	case OctetStream, "text/plain", "text/xml", "application/xml", "binary/octet-stream":
+		return true
+	}
+	return false
+}
+
+// sniff refines the result of http.DetectContentType for a few text formats it does not recognize.
+func sniff(sniffed string, data []byte) string {
+	head := data
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	head = bytes.TrimSpace(head)
+	switch {
+	case bytes.Contains(head, []byte("<svg")):
+		return "image/svg+xml"
+	case (bytes.HasPrefix(head, []byte("{")) || bytes.HasPrefix(head, []byte("["))) && json.Valid(data):
+		return "application/json"
+	}
+	return sniffed
+}
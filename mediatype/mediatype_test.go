@@ -0,0 +1,47 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mediatype
+
+import (
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	png := []byte("\x89PNG\x0D\x0A\x1A\x0A" + "rest")
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		data        string
+		want        string
+	}{
+		{"app.js", "", "console.log('hi');", "text/javascript; charset=utf-8"},
+		{"https://example.com/static/style.css?v=1", "text/plain", "body {}", "text/css; charset=utf-8"},
+		{"", "text/javascript", "console.log('hi');", "text/javascript"},
+		{"", "text/plain", "hello", "text/plain; charset=utf-8"},
+		{"", "", `{"a": 1}`, "application/json"},
+		{"", "", `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"></svg>`, "image/svg+xml"},
+		{"icon.svg", "", `<?xml version="1.0"?><svg></svg>`, "image/svg+xml"},
+		{"module.wasm", "", "\x00asm\x01\x00\x00\x00", "application/wasm"},
+		// Magic bytes win over a misleading name or header.
+		{"image.txt", "text/plain", string(png), "image/png"},
+		{"", "", "\x00\x01\x02", "application/octet-stream"},
+	} {
+		got := Detect(tc.name, tc.contentType, []byte(tc.data))
+		if got != tc.want {
+			t.Errorf("Detect(%q, %q, %q) = %q, want %q", tc.name, tc.contentType, tc.data, got, tc.want)
+		}
+	}
+}
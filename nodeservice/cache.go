@@ -0,0 +1,256 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nodeservice
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/ent/datastore"
+	"github.com/google/ent/log"
+	"github.com/google/ent/utils"
+)
+
+// Cache is an ObjectGetter that keeps a local copy of the objects fetched from Inner in a
+// directory on disk. Objects are verified against their digest when read back. Once the total size
+// of the cache exceeds MaxSize, the least recently used objects are evicted; the modification time
+// of each file is used to record its last access.
+type Cache struct {
+	Inner   ObjectGetter
+	Dir     string
+	MaxSize int64
+
+	store datastore.File
+
+	// mu guards size, and is held while adding or removing objects so that the size is only
+	// accounted once for each of them.
+	mu   sync.Mutex
+	size int64
+}
+
+type CacheEntry struct {
+	Digest     utils.Digest
+	Size       int64
+	LastAccess time.Time
+}
+
+// NewCache creates a cache rooted at dir, creating the directory if necessary. Inner may be nil, in
+// which case only objects already in the cache can be retrieved.
+func NewCache(inner ObjectGetter, dir string, maxSize int64) (*Cache, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("could not create cache directory: %w", err)
+	}
+	c := &Cache{
+		Inner:   inner,
+		Dir:     dir,
+		MaxSize: maxSize,
+		store: datastore.File{
+			DirName: dir,
+		},
+	}
+	entries, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		c.size += e.Size
+	}
+	return c, nil
+}
+
+func (c *Cache) Get(ctx context.Context, digest utils.Digest) ([]byte, error) {
+	b, err := c.store.Get(ctx, digest.String())
+	if err == nil && !utils.MatchesDigest(b, digest) {
+		err = fmt.Errorf("mismatching digest")
+	}
+	if err == nil {
+		log.Debugf(ctx, "cache hit: %s", utils.DigestForLog(digest))
+		c.touch(digest)
+		return b, nil
+	}
+	if err != datastore.ErrNotFound {
+		// The entry exists but could not be read back or failed verification, so drop it in order
+		// for it to be replaced by a good copy below.
+		log.Warningf(ctx, "evicting corrupt cache entry %s: %v", utils.DigestForLog(digest), err)
+		if err := c.evict(digest); err != nil {
+			log.Warningf(ctx, "could not evict %s: %v", utils.DigestForLog(digest), err)
+		}
+	}
+	if c.Inner == nil {
+		return nil, ErrNotFound
+	}
+	log.Debugf(ctx, "cache miss: %s", utils.DigestForLog(digest))
+	b, err = c.Inner.Get(ctx, digest)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Add(ctx, digest, b); err != nil {
+		log.Warningf(ctx, "could not add %s to cache: %v", utils.DigestForLog(digest), err)
+	}
+	return b, nil
+}
+
+func (c *Cache) GetMetadata(ctx context.Context, digest utils.Digest) (utils.Metadata, error) {
+	info, err := os.Stat(filepath.Join(c.Dir, digest.String()))
+	if err == nil {
+		return utils.Metadata{
+			Size: uint64(info.Size()),
+		}, nil
+	}
+	if c.Inner == nil {
+		return utils.Metadata{}, ErrNotFound
+	}
+	return c.Inner.GetMetadata(ctx, digest)
+}
+
+func (c *Cache) Has(ctx context.Context, digest utils.Digest) (bool, error) {
+	ok, err := c.store.Has(ctx, digest.String())
+	if err == nil && ok {
+		return true, nil
+	}
+	if c.Inner == nil {
+		return false, err
+	}
+	return c.Inner.Has(ctx, digest)
+}
+
+// Add stores b in the cache under digest, which may use any supported hash function, evicting
+// older objects if the cache grows beyond its maximum size.
+func (c *Cache) Add(ctx context.Context, digest utils.Digest, b []byte) error {
+	if !utils.MatchesDigest(b, digest) {
+		return fmt.Errorf("object does not match digest %s", utils.DigestForLog(digest))
+	}
+	c.mu.Lock()
+	ok, err := c.store.Has(ctx, digest.String())
+	if err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	if ok {
+		c.mu.Unlock()
+		c.touch(digest)
+		return nil
+	}
+	err = c.store.Put(ctx, digest.String(), b)
+	if err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	c.size += int64(len(b))
+	over := c.MaxSize > 0 && c.size > c.MaxSize
+	c.mu.Unlock()
+	if over {
+		_, _, err := c.Prune(c.MaxSize)
+		return err
+	}
+	return nil
+}
+
+// List returns all the objects currently in the cache, most recently used first.
+func (c *Cache) List() ([]CacheEntry, error) {
+	files, err := os.ReadDir(c.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read cache directory: %w", err)
+	}
+	entries := make([]CacheEntry, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		digest, err := utils.ParseDigest(f.Name())
+		if err != nil {
+			// Not an object, ignore.
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			return nil, fmt.Errorf("could not stat %q: %w", f.Name(), err)
+		}
+		entries = append(entries, CacheEntry{
+			Digest:     digest,
+			Size:       info.Size(),
+			LastAccess: info.ModTime(),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastAccess.After(entries[j].LastAccess)
+	})
+	return entries, nil
+}
+
+// Prune evicts the least recently used objects until the total size of the cache is at most
+// maxSize, and returns the number of objects removed and the number of bytes freed.
+func (c *Cache) Prune(maxSize int64) (int, int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries, err := c.List()
+	if err != nil {
+		return 0, 0, err
+	}
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+	removed := 0
+	var freed int64
+	for i := len(entries) - 1; i >= 0 && total > maxSize; i-- {
+		e := entries[i]
+		err := os.Remove(filepath.Join(c.Dir, e.Digest.String()))
+		if err != nil {
+			return removed, freed, fmt.Errorf("could not remove cache entry: %w", err)
+		}
+		total -= e.Size
+		freed += e.Size
+		removed++
+	}
+	c.size = total
+	return removed, freed, nil
+}
+
+// evict removes a single object from the cache.
+func (c *Cache) evict(digest utils.Digest) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	filename := filepath.Join(c.Dir, digest.String())
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filename); err != nil {
+		return err
+	}
+	c.size -= info.Size()
+	return nil
+}
+
+// Clear removes all the objects from the cache.
+func (c *Cache) Clear() (int, int64, error) {
+	return c.Prune(0)
+}
+
+func (c *Cache) touch(digest utils.Digest) {
+	now := time.Now()
+	err := os.Chtimes(filepath.Join(c.Dir, digest.String()), now, now)
+	if err != nil {
+		log.Warningf(context.Background(), "could not update access time of %s: %v", utils.DigestForLog(digest), err)
+	}
+}
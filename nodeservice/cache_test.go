@@ -0,0 +1,160 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nodeservice
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/ent/datastore"
+	"github.com/google/ent/objectstore"
+	"github.com/google/ent/utils"
+	"github.com/multiformats/go-multihash"
+)
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	inner := objectstore.Store{
+		Inner: datastore.InMemory{
+			Inner: map[string][]byte{},
+		},
+	}
+	a := bytes.Repeat([]byte("a"), 10)
+	b := bytes.Repeat([]byte("b"), 10)
+	digestA, _ := inner.Put(ctx, a)
+	digestB, _ := inner.Put(ctx, b)
+
+	c, err := NewCache(inner, t.TempDir(), 15)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.Get(ctx, digestA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, a) {
+		t.Fatalf("got %q, want %q", got, a)
+	}
+	// Make sure that the access times of the two entries differ.
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(c.Dir, digestA.String()), old, old)
+
+	// Fetching b pushes the cache over its maximum size, so a is evicted.
+	_, err = c.Get(ctx, digestB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := c.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || !bytes.Equal(entries[0].Digest, digestB) {
+		t.Fatalf("unexpected cache entries: %+v", entries)
+	}
+
+	removed, freed, err := c.Clear()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 || freed != 10 {
+		t.Fatalf("got removed=%d freed=%d, want removed=1 freed=10", removed, freed)
+	}
+}
+
+func TestCacheCorrupt(t *testing.T) {
+	ctx := context.Background()
+	inner := objectstore.Store{
+		Inner: datastore.InMemory{
+			Inner: map[string][]byte{},
+		},
+	}
+	a := bytes.Repeat([]byte("a"), 10)
+	digestA, _ := inner.Put(ctx, a)
+
+	c, err := NewCache(inner, t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(c.Dir, digestA.String())
+	if err := os.WriteFile(filename, []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.Get(ctx, digestA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, a) {
+		t.Fatalf("got %q, want %q", got, a)
+	}
+	// The corrupt entry has been replaced by the good copy.
+	stored, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored, a) {
+		t.Fatalf("cache entry not replaced: %q", stored)
+	}
+}
+
+func TestCacheAdd(t *testing.T) {
+	ctx := context.Background()
+	a := bytes.Repeat([]byte("a"), 10)
+	mh, err := multihash.Sum(a, multihash.SHA2_512, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := utils.Digest(mh)
+
+	c, err := NewCache(nil, t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Add(ctx, digest, []byte("other")); err == nil {
+		t.Fatal("expected an error adding an object that does not match its digest")
+	}
+
+	// Concurrent adds of the same object only account for it once.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.Add(ctx, digest, a); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if c.size != int64(len(a)) {
+		t.Fatalf("got size %d, want %d", c.size, len(a))
+	}
+
+	// The object is found under the digest it was added with.
+	got, err := c.Get(ctx, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, a) {
+		t.Fatalf("got %q, want %q", got, a)
+	}
+}
@@ -18,50 +18,323 @@ package nodeservice
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"path"
+	"sync"
+	"time"
 
 	"github.com/google/ent/index"
+	"github.com/google/ent/log"
 	"github.com/google/ent/utils"
 )
 
+// IndexClient is an ObjectGetter backed by a static index, as produced by the indexer. For each
+// object, the index contains an entry listing one or more URLs from which the object may be
+// downloaded; the contents are always verified against the digest before being returned.
 type IndexClient struct {
 	BaseURL string
+	// If Race is true, all the URLs of an entry are fetched concurrently and the first valid
+	// response is used. Otherwise, URLs are tried in order until one of them is valid.
+	Race bool
+	// If RequireSignature is true, entries are only accepted if signed by one of TrustedKeys.
+	TrustedKeys      []*ecdsa.PublicKey
+	RequireSignature bool
+	// If Packed is true, entries are looked up in the packed layout written by index.Pack, instead
+	// of in one file per digest.
+	Packed bool
+	// If Manifests is not nil, the verified manifest of the packed layout is kept in it, instead of
+	// being fetched and verified again on every lookup.
+	Manifests *ManifestCache
 }
 
+// DefaultManifestTTL is how long a cached manifest is used before being fetched again.
+const DefaultManifestTTL = 5 * time.Minute
+
+// ManifestCache holds the last verified manifest of the packed layout of an index. Once it expires,
+// the manifest is fetched again, but its signatures are only verified again if it changed.
+type ManifestCache struct {
+	TTL time.Duration
+
+	mu       sync.Mutex
+	manifest *index.Manifest
+	// SHA-256 digest of the manifest file, whose signatures have been verified.
+	digest  [sha256.Size]byte
+	fetched time.Time
+}
+
+// NewManifestCache returns an empty cache whose manifests expire after ttl, or DefaultManifestTTL if
+// ttl is not positive.
+func NewManifestCache(ttl time.Duration) *ManifestCache {
+	if ttl <= 0 {
+		ttl = DefaultManifestTTL
+	}
+	return &ManifestCache{
+		TTL: ttl,
+	}
+}
+
+// get returns the cached manifest, if it has not expired.
+func (m *ManifestCache) get() (*index.Manifest, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.manifest == nil || time.Since(m.fetched) > m.TTL {
+		return nil, false
+	}
+	return m.manifest, true
+}
+
+// verified reports whether the manifest file with the given digest was already verified.
+func (m *ManifestCache) verified(digest [sha256.Size]byte) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.manifest != nil && m.digest == digest
+}
+
+func (m *ManifestCache) put(digest [sha256.Size]byte, manifest *index.Manifest) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.manifest = manifest
+	m.digest = digest
+	m.fetched = time.Now()
+}
+
+var _ ObjectGetter = IndexClient{}
+
 func (c IndexClient) Get(ctx context.Context, digest utils.Digest) ([]byte, error) {
-	log.Printf("%s\n", string(digest))
-	u := c.BaseURL + "/" + path.Join(index.DigestToPath(digest), index.EntryFilename)
-	log.Printf("fetching entry from %s\n", u)
-	entryRes, err := http.Get(u)
+	entry, err := c.getEntry(ctx, digest)
 	if err != nil {
-		return nil, fmt.Errorf("could not fetch index entry: %w", err)
+		return nil, err
+	}
+	if len(entry.URLS) == 0 {
+		return nil, fmt.Errorf("index entry for %s has no URLs", utils.DigestForLog(digest))
+	}
+	if c.Race {
+		return c.getRace(ctx, digest, entry.URLS)
 	}
-	if entryRes.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("could not fetch index entry: %s", entryRes.Status)
+	for _, u := range entry.URLS {
+		b, err := downloadFromURL(ctx, digest, u)
+		if err != nil {
+			log.Warningf(ctx, "could not fetch %s from %q: %v", utils.DigestForLog(digest), u, err)
+			continue
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("could not fetch %s from any of %d URLs", utils.DigestForLog(digest), len(entry.URLS))
+}
+
+// getRace fetches from all the URLs concurrently, and returns the first valid response, cancelling
+// all the other requests.
+func (c IndexClient) getRace(ctx context.Context, digest utils.Digest, urls []string) ([]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		b   []byte
+		err error
+	}
+	results := make(chan result, len(urls))
+	for _, u := range urls {
+		u := u
+		go func() {
+			b, err := downloadFromURL(ctx, digest, u)
+			if err != nil && ctx.Err() == nil {
+				log.Warningf(ctx, "could not fetch %s from %q: %v", utils.DigestForLog(digest), u, err)
+			}
+			results <- result{b: b, err: err}
+		}()
+	}
+	for range urls {
+		r := <-results
+		if r.err == nil {
+			return r.b, nil
+		}
+	}
+	return nil, fmt.Errorf("could not fetch %s from any of %d URLs", utils.DigestForLog(digest), len(urls))
+}
+
+func (c IndexClient) GetMetadata(ctx context.Context, digest utils.Digest) (utils.Metadata, error) {
+	entry, err := c.getEntry(ctx, digest)
+	if err != nil {
+		return utils.Metadata{}, err
+	}
+	return utils.Metadata{
+		Size:      uint64(entry.Size),
+		MediaType: entry.MediaType,
+	}, nil
+}
+
+func (c IndexClient) Has(ctx context.Context, digest utils.Digest) (bool, error) {
+	_, err := c.getEntry(ctx, digest)
+	if err == ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// getEntry fetches and parses the index entry for the given digest, returning ErrNotFound if the
+// index does not contain it.
+func (c IndexClient) getEntry(ctx context.Context, digest utils.Digest) (index.IndexEntry, error) {
+	if c.Packed {
+		return c.getPackedEntry(ctx, digest)
+	}
+	name := path.Join(index.DigestToPath(digest), index.EntryFilename)
+	b, err := c.getFile(ctx, name)
+	if err != nil {
+		return index.IndexEntry{}, err
+	}
+	if c.RequireSignature {
+		err := c.verifyFile(ctx, name, b)
+		if err != nil {
+			return index.IndexEntry{}, fmt.Errorf("index entry for %s rejected: %w", utils.DigestForLog(digest), err)
+		}
 	}
 	entry := index.IndexEntry{}
-	err = json.NewDecoder(entryRes.Body).Decode(&entry)
+	err = json.Unmarshal(b, &entry)
+	if err != nil {
+		return index.IndexEntry{}, fmt.Errorf("could not parse index entry as JSON: %w", err)
+	}
+	log.Debugf(ctx, "parsed entry: %+v", entry)
+	// A signature only vouches for the entry itself, so an entry for another object, even if
+	// validly signed, must not be accepted in place of this one.
+	if !entryMatches(entry, digest) {
+		return index.IndexEntry{}, fmt.Errorf("index entry for %s is for another digest: %q", utils.DigestForLog(digest), entry.Digest)
+	}
+	return entry, nil
+}
+
+// entryMatches reports whether e is the entry for digest. Older indexers recorded the raw bytes of
+// the multihash instead of its human readable form.
+func entryMatches(e index.IndexEntry, digest utils.Digest) bool {
+	return e.Digest == utils.DigestToHumanString(digest) || e.Digest == string(digest)
+}
+
+// getPackedEntry looks up the entry for the given digest in the packed layout of the index. Only
+// the manifest needs to be signed, since it pins the digests of the shards.
+func (c IndexClient) getPackedEntry(ctx context.Context, digest utils.Digest) (index.IndexEntry, error) {
+	m, err := c.getManifest(ctx)
+	if err != nil {
+		return index.IndexEntry{}, err
+	}
+	shard, ok := m.Find(digest)
+	if !ok {
+		return index.IndexEntry{}, ErrNotFound
+	}
+	sb, err := c.getFile(ctx, path.Join(index.PackedDir, index.ObjectsDir, shard.Digest))
+	if err != nil {
+		return index.IndexEntry{}, fmt.Errorf("could not fetch index shard %q: %w", shard.Prefix, err)
+	}
+	err = index.VerifyShard(shard, sb)
+	if err != nil {
+		return index.IndexEntry{}, err
+	}
+	entry, err := index.FindEntry(sb, digest)
 	if err != nil {
-		return nil, fmt.Errorf("could not parse index entry as JSON: %w", err)
+		return index.IndexEntry{}, err
+	}
+	if entry == nil {
+		return index.IndexEntry{}, ErrNotFound
+	}
+	if !entryMatches(*entry, digest) {
+		return index.IndexEntry{}, fmt.Errorf("index entry for %s is for another digest: %q", utils.DigestForLog(digest), entry.Digest)
 	}
-	log.Printf("parsed entry: %+v", entry)
-	return DownloadFromURL(digest, entry.URLS[0])
+	log.Debugf(ctx, "found entry in shard %q: %+v", shard.Prefix, entry)
+	return *entry, nil
 }
 
-func (c IndexClient) Has(ctx context.Context, h utils.Digest) (bool, error) {
-	return false, nil
+// getManifest returns the manifest of the packed layout, from Manifests if it holds one that has not
+// expired.
+func (c IndexClient) getManifest(ctx context.Context) (*index.Manifest, error) {
+	if c.Manifests != nil {
+		if m, ok := c.Manifests.get(); ok {
+			return m, nil
+		}
+	}
+	name := path.Join(index.PackedDir, index.ManifestFilename)
+	b, err := c.getFile(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch index manifest: %w", err)
+	}
+	h := sha256.Sum256(b)
+	if c.RequireSignature && !(c.Manifests != nil && c.Manifests.verified(h)) {
+		err := c.verifyFile(ctx, name, b)
+		if err != nil {
+			return nil, fmt.Errorf("index manifest rejected: %w", err)
+		}
+	}
+	m := &index.Manifest{}
+	err = json.Unmarshal(b, m)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse index manifest as JSON: %w", err)
+	}
+	if c.Manifests != nil {
+		c.Manifests.put(h, m)
+	}
+	return m, nil
+}
+
+// verifyFile checks that the detached signatures of the named file include one by a trusted key.
+func (c IndexClient) verifyFile(ctx context.Context, name string, b []byte) error {
+	sb, err := c.getFile(ctx, name+".sig")
+	if err == ErrNotFound {
+		return fmt.Errorf("not signed")
+	} else if err != nil {
+		return err
+	}
+	sigs := []index.Signature{}
+	err = json.Unmarshal(sb, &sigs)
+	if err != nil {
+		return fmt.Errorf("could not parse signatures as JSON: %w", err)
+	}
+	return index.VerifySignatures(b, sigs, c.TrustedKeys)
+}
+
+// getFile fetches the file at the given path relative to the index, returning ErrNotFound if it
+// does not exist.
+func (c IndexClient) getFile(ctx context.Context, name string) ([]byte, error) {
+	u := c.BaseURL + "/" + name
+	log.Debugf(ctx, "fetching %s", u)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %w", err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch %s: %w", name, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not fetch %s: %s", name, res.Status)
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", name, err)
+	}
+	return b, nil
 }
 
 func DownloadFromURL(digest utils.Digest, url string) ([]byte, error) {
-	targetRes, err := http.Get(url)
+	return downloadFromURL(context.Background(), digest, url)
+}
+
+func downloadFromURL(ctx context.Context, digest utils.Digest, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %v", err)
+	}
+	targetRes, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("could not fetch target: %v", err)
 	}
+	defer targetRes.Body.Close()
 	if targetRes.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("could not fetch target: %s", targetRes.Status)
 	}
@@ -0,0 +1,262 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nodeservice
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/ent/index"
+	"github.com/google/ent/utils"
+)
+
+func TestIndexClient(t *testing.T) {
+	ctx := context.Background()
+	b := []byte("hello")
+	digest := utils.ComputeDigest(b)
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mux.HandleFunc("/index/"+path.Join(index.DigestToPath(digest), index.EntryFilename), func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(index.IndexEntry{
+			MediaType: "text/plain",
+			Digest:    utils.DigestToHumanString(digest),
+			Size:      len(b),
+			URLS: []string{
+				server.URL + "/missing",
+				server.URL + "/corrupt",
+				server.URL + "/ok",
+			},
+		})
+	})
+	mux.HandleFunc("/corrupt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("corrupt"))
+	})
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(b)
+	})
+
+	for _, race := range []bool{false, true} {
+		c := IndexClient{
+			BaseURL: server.URL + "/index",
+			Race:    race,
+		}
+		got, err := c.Get(ctx, digest)
+		if err != nil {
+			t.Fatalf("race=%v: %v", race, err)
+		}
+		if !bytes.Equal(got, b) {
+			t.Fatalf("race=%v: got %q, want %q", race, got, b)
+		}
+	}
+
+	c := IndexClient{
+		BaseURL: server.URL + "/index",
+	}
+	ok, err := c.Has(ctx, digest)
+	if err != nil || !ok {
+		t.Fatalf("Has(present) = %v, %v", ok, err)
+	}
+	ok, err = c.Has(ctx, utils.ComputeDigest([]byte("other")))
+	if err != nil || ok {
+		t.Fatalf("Has(missing) = %v, %v", ok, err)
+	}
+	m, err := c.GetMetadata(ctx, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Size != uint64(len(b)) || m.MediaType != "text/plain" {
+		t.Fatalf("unexpected metadata: %+v", m)
+	}
+}
+
+func TestIndexClientSignature(t *testing.T) {
+	ctx := context.Background()
+	b := []byte("hello")
+	digest := utils.ComputeDigest(b)
+	dir := t.TempDir()
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+
+	_, err := index.Add(dir, b, "", server.URL+"/object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	c := IndexClient{
+		BaseURL:          server.URL,
+		TrustedKeys:      []*ecdsa.PublicKey{&key.PublicKey},
+		RequireSignature: true,
+	}
+	if _, err := c.GetMetadata(ctx, digest); err == nil {
+		t.Fatalf("expected unsigned entry to be rejected")
+	}
+	if err := index.SignEntry(dir, digest, other); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetMetadata(ctx, digest); err == nil {
+		t.Fatalf("expected entry signed by untrusted key to be rejected")
+	}
+	if err := index.SignEntry(dir, digest, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetMetadata(ctx, digest); err != nil {
+		t.Fatalf("expected entry signed by trusted key to be accepted: %v", err)
+	}
+
+	// A validly signed entry served under the path of another digest is rejected.
+	otherDigest := utils.ComputeDigest([]byte("other"))
+	from := filepath.Join(dir, index.DigestToPath(digest))
+	to := filepath.Join(dir, index.DigestToPath(otherDigest))
+	if err := os.MkdirAll(to, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{index.EntryFilename, index.SignatureFilename} {
+		if err := os.Rename(filepath.Join(from, name), filepath.Join(to, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.GetMetadata(ctx, otherDigest); err == nil {
+		t.Fatalf("expected entry for another digest to be rejected")
+	}
+}
+
+func TestIndexClientPacked(t *testing.T) {
+	ctx := context.Background()
+	b := []byte("hello")
+	digest := utils.ComputeDigest(b)
+	dir := t.TempDir()
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+
+	_, err := index.Add(dir, b, "text/plain", server.URL+"/object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = index.Add(dir, []byte("other"), "", server.URL+"/other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = index.Pack(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Make sure that only the packed layout is used.
+	err = os.RemoveAll(filepath.Join(dir, "sha256"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := IndexClient{
+		BaseURL: server.URL,
+		Packed:  true,
+	}
+	m, err := c.GetMetadata(ctx, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Size != uint64(len(b)) || m.MediaType != "text/plain" {
+		t.Fatalf("unexpected metadata: %+v", m)
+	}
+	_, err = c.GetMetadata(ctx, utils.ComputeDigest([]byte("missing")))
+	if err != ErrNotFound {
+		t.Fatalf("GetMetadata(missing) = %v, want ErrNotFound", err)
+	}
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.TrustedKeys = []*ecdsa.PublicKey{&key.PublicKey}
+	c.RequireSignature = true
+	if _, err := c.GetMetadata(ctx, digest); err == nil {
+		t.Fatalf("expected unsigned manifest to be rejected")
+	}
+	if err := index.SignManifest(dir, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetMetadata(ctx, digest); err != nil {
+		t.Fatalf("expected signed manifest to be accepted: %v", err)
+	}
+}
+
+func TestIndexClientManifestCache(t *testing.T) {
+	ctx := context.Background()
+	b := []byte("hello")
+	digest := utils.ComputeDigest(b)
+	dir := t.TempDir()
+	var mu sync.Mutex
+	fetches := map[string]int{}
+	files := http.FileServer(http.Dir(dir))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetches[path.Base(r.URL.Path)]++
+		mu.Unlock()
+		files.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	_, err := index.Add(dir, b, "", server.URL+"/object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = index.Pack(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err := index.SignManifest(dir, key); err != nil {
+		t.Fatal(err)
+	}
+
+	c := IndexClient{
+		BaseURL:          server.URL,
+		TrustedKeys:      []*ecdsa.PublicKey{&key.PublicKey},
+		RequireSignature: true,
+		Packed:           true,
+		Manifests:        NewManifestCache(time.Hour),
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetMetadata(ctx, digest); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fetches[index.ManifestFilename] != 1 || fetches[index.ManifestFilename+".sig"] != 1 {
+		t.Fatalf("manifest fetched %d times and signatures %d times, want once each", fetches[index.ManifestFilename], fetches[index.ManifestFilename+".sig"])
+	}
+
+	// Once expired, the manifest is fetched again, but its signatures are not verified again
+	// since it did not change.
+	c.Manifests.TTL = 0
+	if _, err := c.GetMetadata(ctx, digest); err != nil {
+		t.Fatal(err)
+	}
+	if fetches[index.ManifestFilename] != 2 || fetches[index.ManifestFilename+".sig"] != 1 {
+		t.Fatalf("manifest fetched %d times and signatures %d times, want 2 and 1", fetches[index.ManifestFilename], fetches[index.ManifestFilename+".sig"])
+	}
+}
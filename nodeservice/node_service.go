@@ -23,7 +23,9 @@ import (
 
 type ObjectGetter interface {
 	Get(ctx context.Context, h utils.Digest) ([]byte, error)
-	// TODO: GetMetadata
+	// GetMetadata returns what is known about the object without fetching its contents, or
+	// ErrNotFound if the object is not available.
+	GetMetadata(ctx context.Context, h utils.Digest) (utils.Metadata, error)
 	Has(ctx context.Context, h utils.Digest) (bool, error)
 }
 
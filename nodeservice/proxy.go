@@ -0,0 +1,72 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nodeservice
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/ent/log"
+	"github.com/google/ent/utils"
+)
+
+// Proxy is an ObjectStore that serves objects from Local, and fetches objects missing from Local from
+// Upstream instead. Objects fetched from Upstream are verified and persisted to Local before being
+// returned, so that Local warms up over time.
+//
+// Has and GetMetadata only report objects that are present in Local, so that callers deciding
+// whether to store an object locally are not misled by its availability upstream.
+type Proxy struct {
+	Local    ObjectStore
+	Upstream ObjectGetter
+}
+
+var _ ObjectStore = Proxy{}
+
+func (s Proxy) Get(ctx context.Context, digest utils.Digest) ([]byte, error) {
+	b, err := s.Local.Get(ctx, digest)
+	if err == nil {
+		return b, nil
+	}
+	log.Debugf(ctx, "local miss for %s: %v", utils.DigestForLog(digest), err)
+	b, err = s.Upstream.Get(ctx, digest)
+	if err != nil {
+		return nil, err
+	}
+	if !utils.MatchesDigest(b, digest) {
+		return nil, fmt.Errorf("mismatching digest from upstream: wanted:%q", digest.String())
+	}
+	_, err = s.Local.Put(ctx, b)
+	if err != nil {
+		// The object is still valid, so serve it anyways.
+		log.Errorf(ctx, "could not persist %s fetched from upstream: %v", utils.DigestForLog(digest), err)
+	} else {
+		log.Infof(ctx, "persisted %s fetched from upstream", utils.DigestForLog(digest))
+	}
+	return b, nil
+}
+
+func (s Proxy) GetMetadata(ctx context.Context, digest utils.Digest) (utils.Metadata, error) {
+	return s.Local.GetMetadata(ctx, digest)
+}
+
+func (s Proxy) Has(ctx context.Context, digest utils.Digest) (bool, error) {
+	return s.Local.Has(ctx, digest)
+}
+
+func (s Proxy) Put(ctx context.Context, b []byte) (utils.Digest, error) {
+	return s.Local.Put(ctx, b)
+}
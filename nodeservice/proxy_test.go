@@ -0,0 +1,94 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nodeservice
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/google/ent/datastore"
+	"github.com/google/ent/objectstore"
+	"github.com/google/ent/utils"
+	"github.com/multiformats/go-multihash"
+)
+
+func TestProxy(t *testing.T) {
+	ctx := context.Background()
+	local := objectstore.Store{
+		Inner: datastore.InMemory{
+			Inner: map[string][]byte{},
+		},
+	}
+	upstream := objectstore.Store{
+		Inner: datastore.InMemory{
+			Inner: map[string][]byte{},
+		},
+	}
+	b := []byte("hello")
+	digest, _ := upstream.Put(ctx, b)
+	p := Proxy{
+		Local:    local,
+		Upstream: upstream,
+	}
+
+	ok, _ := p.Has(ctx, digest)
+	if ok {
+		t.Fatalf("object should not be reported as present before being fetched")
+	}
+	got, err := p.Get(ctx, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, b) {
+		t.Fatalf("got %q, want %q", got, b)
+	}
+	ok, _ = local.Has(ctx, digest)
+	if !ok {
+		t.Fatalf("object should have been persisted locally")
+	}
+}
+
+func TestProxySHA512(t *testing.T) {
+	ctx := context.Background()
+	b := []byte("hello")
+	digest, err := multihash.Sum(b, multihash.SHA2_512, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Proxy{
+		Local: objectstore.Store{
+			Inner: datastore.InMemory{
+				Inner: map[string][]byte{},
+			},
+		},
+		Upstream: fakeGetter{b: b},
+	}
+	got, err := p.Get(ctx, utils.Digest(digest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, b) {
+		t.Fatalf("got %q, want %q", got, b)
+	}
+
+	// Content that does not match the digest is rejected.
+	p.Upstream = fakeGetter{b: []byte("other")}
+	_, err = p.Get(ctx, utils.Digest(digest))
+	if err == nil {
+		t.Fatal("expected an error for mismatching content from upstream")
+	}
+}
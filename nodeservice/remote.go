@@ -16,16 +16,24 @@
 package nodeservice
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
 	"fmt"
 	"io"
+	"net/url"
 
+	// Also registers the compressors that remotes may be configured with.
+	"github.com/google/ent/compression"
+	"github.com/google/ent/datastore"
 	"github.com/google/ent/log"
 	pb "github.com/google/ent/proto"
 	"github.com/google/ent/utils"
-	"github.com/schollz/progressbar/v3"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding"
 	"google.golang.org/grpc/metadata"
 )
 
@@ -41,9 +49,13 @@ const (
 )
 
 var (
-	ErrNotFound = fmt.Errorf("not found")
+	// Same as datastore.ErrNotFound, so that callers do not need to care about which layer an
+	// object is missing from.
+	ErrNotFound = datastore.ErrNotFound
 )
 
+var _ ObjectStore = Remote{}
+
 func (s Remote) Get(ctx context.Context, digest utils.Digest) ([]byte, error) {
 	md := metadata.New(nil)
 	md.Set(APIKeyHeader, s.APIKey)
@@ -65,18 +77,76 @@ func (s Remote) Get(ctx context.Context, digest utils.Digest) ([]byte, error) {
 	return res.GetChunk().Data, nil
 }
 
-func (s Remote) Put(ctx context.Context, size uint64, r io.Reader) (utils.Digest, error) {
+// DialRemote returns a Remote that talks to the gRPC API of the ent-server at the given URL. The
+// connection is established lazily, on the first request.
+func DialRemote(apiURL string, apiKey string, opts ...grpc.DialOption) (Remote, error) {
+	parsedURL, err := url.Parse(apiURL)
+	if err != nil {
+		return Remote{}, fmt.Errorf("failed to parse url: %w", err)
+	}
+
+	o := []grpc.DialOption{}
+	if parsedURL.Scheme == "http" {
+		o = append(o, grpc.WithInsecure())
+	} else {
+		o = append(o, grpc.WithTransportCredentials(credentials.NewTLS(nil)))
+	}
+	port := parsedURL.Port()
+	if port == "" {
+		if parsedURL.Scheme == "http" {
+			port = "80"
+		} else {
+			port = "443"
+		}
+	}
+	o = append(o, opts...)
+	cc, err := grpc.Dial(parsedURL.Hostname()+":"+port, o...)
+	if err != nil {
+		return Remote{}, fmt.Errorf("failed to dial: %w", err)
+	}
+	return Remote{
+		APIURL: apiURL,
+		APIKey: apiKey,
+		GRPC:   pb.NewEntClient(cc),
+	}, nil
+}
+
+// WithCompressor returns the options to compress the messages sent to a remote with the named
+// compressor, either "gzip" or "zstd", or none if name is empty; names should be checked with
+// compression.CheckGRPCCompressor when loading the config. Objects that are not worth compressing
+// are sent uncompressed regardless. The server makes the same decision for each object it returns,
+// among the compressors registered by the client, which include both.
+func WithCompressor(name string) []grpc.DialOption {
+	if name == "" {
+		return nil
+	}
+	return []grpc.DialOption{grpc.WithDefaultCallOptions(grpc.UseCompressor(name))}
+}
+
+func (s Remote) Put(ctx context.Context, b []byte) (utils.Digest, error) {
+	opts := []grpc.CallOption{}
+	if !compression.Worthwhile(b) {
+		opts = append(opts, grpc.UseCompressor(encoding.Identity))
+	}
+	return s.putReader(ctx, uint64(len(b)), bytes.NewReader(b), opts...)
+}
+
+// PutReader uploads the object read from r, which is expected to be size bytes long.
+func (s Remote) PutReader(ctx context.Context, size uint64, r io.Reader) (utils.Digest, error) {
+	return s.putReader(ctx, size, r)
+}
+
+func (s Remote) putReader(ctx context.Context, size uint64, r io.Reader, opts ...grpc.CallOption) (utils.Digest, error) {
 	md := metadata.New(nil)
 	md.Set(APIKeyHeader, s.APIKey)
 	ctx = metadata.NewOutgoingContext(ctx, md)
 
-	c, err := s.GRPC.PutEntry(ctx)
+	c, err := s.GRPC.PutEntry(ctx, opts...)
 	if err != nil {
 		return nil, err
 	}
 
 	chunk := make([]byte, chunkSize)
-	bar := progressbar.DefaultBytes(int64(size))
 	for {
 		n, err := r.Read(chunk)
 		if err == io.EOF {
@@ -93,9 +163,7 @@ func (s Remote) Put(ctx context.Context, size uint64, r io.Reader) (utils.Digest
 		if err != nil {
 			return nil, err
 		}
-		bar.Add(n)
 	}
-	bar.Finish()
 	log.Debugf(ctx, "done sending chunks")
 
 	res, err := c.CloseAndRecv()
@@ -112,6 +180,30 @@ func (s Remote) Put(ctx context.Context, size uint64, r io.Reader) (utils.Digest
 	return digest, nil
 }
 
+func (s Remote) GetMetadata(ctx context.Context, digest utils.Digest) (utils.Metadata, error) {
+	md := metadata.New(nil)
+	md.Set(APIKeyHeader, s.APIKey)
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	req := pb.GetEntryMetadataRequest{
+		Digest: utils.DigestToProto(digest),
+	}
+	res, err := s.GRPC.GetEntryMetadata(ctx, &req)
+	if grpc.Code(err) == codes.NotFound {
+		return utils.Metadata{}, ErrNotFound
+	} else if err != nil {
+		return utils.Metadata{}, err
+	}
+	m := utils.Metadata{
+		Size:      res.GetMetadata().GetSize(),
+		MediaType: res.GetMetadata().GetMediaType(),
+	}
+	if t := res.GetMetadata().GetCreationTime(); t != nil {
+		m.CreationTime = t.AsTime()
+	}
+	return m, nil
+}
+
 func (s Remote) Has(ctx context.Context, digest utils.Digest) (bool, error) {
 	log.Debugf(ctx, "checking existence of %s", utils.DigestForLog(digest))
 	md := metadata.New(nil)
@@ -135,3 +227,69 @@ func (s Remote) Has(ctx context.Context, digest utils.Digest) (bool, error) {
 
 	return ok, nil
 }
+
+// GetTag returns the tag with the given label signed by publicKey, or ErrNotFound if there is none.
+// The signature of the tag is verified.
+func (s Remote) GetTag(ctx context.Context, publicKey *ecdsa.PublicKey, label string) (*pb.SignedTag, error) {
+	md := metadata.New(nil)
+	md.Set(APIKeyHeader, s.APIKey)
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	pk, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	req := pb.GetTagRequest{
+		PublicKey: pk,
+		Label:     label,
+	}
+	res, err := s.GRPC.GetTag(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+	if res.GetSignedTag() == nil {
+		return nil, ErrNotFound
+	}
+	signer, err := utils.VerifyTag(res.SignedTag)
+	if err != nil {
+		return nil, err
+	}
+	if !signer.Equal(publicKey) || res.SignedTag.Tag.Label != label || res.SignedTag.Tag.Target == nil {
+		return nil, fmt.Errorf("tag does not match request")
+	}
+	return res.SignedTag, nil
+}
+
+// LatestTag returns the version of the tag with the given label signed by publicKey that has the
+// highest sequence number among the remotes, or ErrNotFound if none of them has it. Remotes that
+// fail are skipped.
+func LatestTag(ctx context.Context, remotes []Remote, publicKey *ecdsa.PublicKey, label string) (*pb.SignedTag, error) {
+	var latest *pb.SignedTag
+	for _, r := range remotes {
+		st, err := r.GetTag(ctx, publicKey, label)
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			log.Warningf(ctx, "could not get tag from %s: %v", r.APIURL, err)
+			continue
+		}
+		if latest == nil || st.Tag.Sequence > latest.Tag.Sequence {
+			latest = st
+		}
+	}
+	if latest == nil {
+		return nil, ErrNotFound
+	}
+	return latest, nil
+}
+
+func (s Remote) SetTag(ctx context.Context, st *pb.SignedTag) error {
+	md := metadata.New(nil)
+	md.Set(APIKeyHeader, s.APIKey)
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	_, err := s.GRPC.SetTag(ctx, &pb.SetTagRequest{
+		SignedTag: st,
+	})
+	return err
+}
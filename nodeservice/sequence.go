@@ -16,50 +16,193 @@
 package nodeservice
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/google/ent/log"
 	"github.com/google/ent/utils"
+	"google.golang.org/grpc"
 )
 
+type FetchMode int
+
+const (
+	// Query remotes one at a time, in order, until one returns the object.
+	FetchSequential FetchMode = iota
+	// Query all remotes at once, and use the first valid response.
+	FetchRace
+	// Query remotes in order, starting the next one after HedgeDelay if no valid response has been
+	// received yet, and use the first valid response.
+	FetchHedged
+)
+
+func ParseFetchMode(s string) (FetchMode, error) {
+	switch s {
+	case "", "sequential":
+		return FetchSequential, nil
+	case "race":
+		return FetchRace, nil
+	case "hedged":
+		return FetchHedged, nil
+	default:
+		return FetchSequential, fmt.Errorf("invalid fetch mode: %q", s)
+	}
+}
+
+const defaultHedgeDelay = 100 * time.Millisecond
+
+// Sequence is an ObjectGetter that fetches objects from multiple remotes, according to Mode.
+// Responses are verified against the requested digest, and invalid ones are treated as errors.
+//
+// If Stats is not nil, the latency and outcome of each request is recorded in it, and remotes are
+// tried in order of past performance rather than in the order of Inner.
 type Sequence struct {
-	Inner []Inner
+	Inner      []Inner
+	Mode       FetchMode
+	HedgeDelay time.Duration
+	Stats      *Stats
+
+	WritePolicy WritePolicy
+	Background  *sync.WaitGroup
+	// OnBackgroundResult, if set, is called with the final result of each write that was still
+	// pending when PutAll returned, once it completes.
+	OnBackgroundResult func(digest utils.Digest, r PutResult)
 }
 
 type Inner struct {
 	Name         string
 	ObjectGetter ObjectGetter
+	// Whether objects are written to this remote on Put.
+	Write bool
 }
 
-func NewRemote(name string, url string, apiKey string) Inner {
-	return Inner{
-		Name: name,
-		ObjectGetter: Remote{
-			APIURL: url,
-			APIKey: apiKey,
-		},
+// NewRemote dials the remote at url and returns it as an Inner with the given name.
+func NewRemote(name string, url string, apiKey string, opts ...grpc.DialOption) (Inner, error) {
+	remote, err := DialRemote(url, apiKey, opts...)
+	if err != nil {
+		return Inner{}, fmt.Errorf("could not dial remote %q: %w", name, err)
 	}
+	return Inner{
+		Name:         name,
+		ObjectGetter: remote,
+	}, nil
 }
 
 func (s Sequence) Get(ctx context.Context, digest utils.Digest) ([]byte, error) {
+	inner := s.Inner
+	if s.Stats != nil {
+		inner = s.Stats.order(inner)
+	}
+	switch s.Mode {
+	case FetchRace:
+		return s.getParallel(ctx, digest, inner, 0)
+	case FetchHedged:
+		delay := s.HedgeDelay
+		if delay <= 0 {
+			delay = defaultHedgeDelay
+		}
+		return s.getParallel(ctx, digest, inner, delay)
+	default:
+		for _, ss := range inner {
+			b, err := s.fetch(ctx, ss, digest)
+			if err != nil {
+				continue
+			}
+			return b, nil
+		}
+		return nil, ErrNotFound
+	}
+}
+
+// getParallel starts fetching from the first remote, and from each following remote either once
+// delay has elapsed since the previous one was started, or as soon as an earlier one fails, and
+// returns the first valid response, cancelling all the other requests. With a zero delay, all the
+// remotes are started at once.
+func (s Sequence) getParallel(ctx context.Context, digest utils.Digest, inner []Inner, delay time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		b   []byte
+		err error
+	}
+	results := make(chan result, len(inner))
+	next := 0
+	pending := 0
+	start := func() {
+		ss := inner[next]
+		next++
+		pending++
+		go func() {
+			b, err := s.fetch(ctx, ss, digest)
+			results <- result{b: b, err: err}
+		}()
+	}
+	for next < len(inner) && (next == 0 || delay <= 0) {
+		start()
+	}
+	for pending > 0 {
+		var hedge <-chan time.Time
+		if next < len(inner) {
+			hedge = time.After(delay)
+		}
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				return r.b, nil
+			}
+			if next < len(inner) {
+				start()
+			}
+		case <-hedge:
+			start()
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// fetch gets the object from a single remote, verifies it, and records the outcome.
+func (s Sequence) fetch(ctx context.Context, ss Inner, digest utils.Digest) ([]byte, error) {
+	start := time.Now()
+	b, err := ss.ObjectGetter.Get(ctx, digest)
+	if err == nil && !utils.MatchesDigest(b, digest) {
+		err = fmt.Errorf("mismatching digest")
+	}
+	elapsed := time.Since(start)
+	if ctx.Err() != nil {
+		// Cancelled because another remote won the race; this says nothing about this remote.
+		return nil, ctx.Err()
+	}
+	if s.Stats != nil {
+		s.Stats.record(ss.Name, elapsed, err)
+	}
+	if err == ErrNotFound {
+		log.Infof(ctx, "object %s not found in %s", digest, ss.Name)
+		return nil, err
+	} else if err != nil {
+		log.Errorf(ctx, "error fetching (get %q) from remote %q: %v", digest, ss.Name, err)
+		return nil, err
+	}
+	log.Infof(ctx, "fetched %q from remote %q in %v", digest, ss.Name, elapsed)
+	return b, nil
+}
+
+// GetMetadata returns the metadata from the first remote that knows about the object.
+func (s Sequence) GetMetadata(ctx context.Context, digest utils.Digest) (utils.Metadata, error) {
 	for _, ss := range s.Inner {
-		start := time.Now()
-		b, err := ss.ObjectGetter.Get(ctx, digest)
+		m, err := ss.ObjectGetter.GetMetadata(ctx, digest)
 		if err == ErrNotFound {
-			log.Infof(ctx, "object %s not found in %s", digest, ss.Name)
 			continue
 		} else if err != nil {
-			log.Errorf(ctx, "error fetching (get %q) from remote %q: %v", digest, ss.Name, err)
+			log.Errorf(ctx, "error fetching (metadata %q) from remote %q: %v", digest, ss.Name, err)
 			continue
 		}
-		end := time.Now()
-		elapsed := end.Sub(start)
-		log.Infof(ctx, "fetched %q from remote %q in %v", digest, ss.Name, elapsed)
-		return b, nil
+		return m, nil
 	}
-	return nil, ErrNotFound
+	return utils.Metadata{}, ErrNotFound
 }
 
 func (s Sequence) Has(ctx context.Context, digest utils.Digest) (bool, error) {
@@ -76,7 +219,162 @@ func (s Sequence) Has(ctx context.Context, digest utils.Digest) (bool, error) {
 	return false, nil
 }
 
+type WritePolicy int
+
+const (
+	// Put returns once all writable remotes have the object, and fails if any of them fails.
+	WriteAll WritePolicy = iota
+	// Put returns once a majority of writable remotes have the object; the remaining writes
+	// continue in the background.
+	WriteQuorum
+	// Put returns once any writable remote has the object; the remaining writes continue in the
+	// background.
+	WriteFirst
+)
+
+func ParseWritePolicy(s string) (WritePolicy, error) {
+	switch s {
+	case "", "all":
+		return WriteAll, nil
+	case "quorum":
+		return WriteQuorum, nil
+	case "first":
+		return WriteFirst, nil
+	default:
+		return WriteAll, fmt.Errorf("invalid write policy: %q", s)
+	}
+}
+
+type PutStatus int
+
+const (
+	// The remote already had the object.
+	PutExisted PutStatus = iota
+	PutUploaded
+	PutFailed
+	// The write is still in progress in the background.
+	PutPending
+)
+
+type PutResult struct {
+	Name   string
+	Status PutStatus
+	Err    error
+}
+
 func (s Sequence) Put(ctx context.Context, b []byte) (utils.Digest, error) {
-	// return s.Inner[0].Put(ctx, b)
-	return utils.Digest{}, fmt.Errorf("not implemented")
+	digest, _, err := s.PutAll(ctx, b)
+	return digest, err
+}
+
+// PutAll writes b to all the Inner remotes marked as Write (whose ObjectGetter must also be an
+// ObjectStore), concurrently, and returns once WritePolicy is satisfied, with the status of each
+// remote in the order of Inner. Writes that are still in progress at that point are tracked by
+// Background, if set, so that callers can wait for them to complete.
+func (s Sequence) PutAll(ctx context.Context, b []byte) (utils.Digest, []PutResult, error) {
+	digest := utils.ComputeDigest(b)
+	writers := []Inner{}
+	for _, ss := range s.Inner {
+		if ss.Write {
+			writers = append(writers, ss)
+		}
+	}
+	if len(writers) == 0 {
+		return digest, nil, fmt.Errorf("no writable remotes")
+	}
+	needed := len(writers)
+	switch s.WritePolicy {
+	case WriteQuorum:
+		needed = len(writers)/2 + 1
+	case WriteFirst:
+		needed = 1
+	}
+
+	type indexedResult struct {
+		i int
+		r PutResult
+	}
+	done := make(chan indexedResult, len(writers))
+	if s.Background != nil {
+		s.Background.Add(len(writers))
+	}
+	for i, ss := range writers {
+		i, ss := i, ss
+		go func() {
+			if s.Background != nil {
+				defer s.Background.Done()
+			}
+			// Writes may outlive the call, so they must not be cancelled when it returns.
+			r := put(context.Background(), ss, digest, b)
+			if r.Err != nil {
+				log.Errorf(ctx, "error writing %s to remote %q: %v", utils.DigestForLog(digest), ss.Name, r.Err)
+			}
+			done <- indexedResult{i: i, r: r}
+		}()
+	}
+
+	results := make([]PutResult, len(writers))
+	for i, ss := range writers {
+		results[i] = PutResult{
+			Name:   ss.Name,
+			Status: PutPending,
+		}
+	}
+	succeeded := 0
+	failed := 0
+	for succeeded < needed && succeeded+failed < len(writers) {
+		r := <-done
+		results[r.i] = r.r
+		if r.r.Err == nil {
+			succeeded++
+		} else {
+			failed++
+		}
+	}
+	if remaining := len(writers) - succeeded - failed; remaining > 0 && s.OnBackgroundResult != nil {
+		if s.Background != nil {
+			s.Background.Add(1)
+		}
+		go func() {
+			if s.Background != nil {
+				defer s.Background.Done()
+			}
+			for i := 0; i < remaining; i++ {
+				r := <-done
+				s.OnBackgroundResult(digest, r.r)
+			}
+		}()
+	}
+	if succeeded < needed {
+		return digest, results, fmt.Errorf("could only write to %d of %d required remotes", succeeded, needed)
+	}
+	return digest, results, nil
+}
+
+func put(ctx context.Context, ss Inner, digest utils.Digest, b []byte) PutResult {
+	r := PutResult{
+		Name: ss.Name,
+	}
+	store, ok := ss.ObjectGetter.(ObjectStore)
+	if !ok {
+		r.Status = PutFailed
+		r.Err = fmt.Errorf("remote is not writable")
+		return r
+	}
+	exists, err := store.Has(ctx, digest)
+	if err == nil && exists {
+		r.Status = PutExisted
+		return r
+	}
+	putDigest, err := store.Put(ctx, b)
+	if err == nil && !bytes.Equal(putDigest, digest) {
+		err = fmt.Errorf("mismatching digest: wanted:%q got:%q", digest.String(), putDigest.String())
+	}
+	if err != nil {
+		r.Status = PutFailed
+		r.Err = err
+		return r
+	}
+	r.Status = PutUploaded
+	return r
 }
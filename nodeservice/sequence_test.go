@@ -0,0 +1,234 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nodeservice
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/ent/datastore"
+	"github.com/google/ent/objectstore"
+	"github.com/google/ent/utils"
+	"github.com/multiformats/go-multihash"
+)
+
+// fakeGetter returns the given bytes for any digest after a delay, or until cancelled.
+type fakeGetter struct {
+	b     []byte
+	delay time.Duration
+}
+
+func (g fakeGetter) Get(ctx context.Context, digest utils.Digest) ([]byte, error) {
+	select {
+	case <-time.After(g.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if g.b == nil {
+		return nil, ErrNotFound
+	}
+	return g.b, nil
+}
+
+func (g fakeGetter) GetMetadata(ctx context.Context, digest utils.Digest) (utils.Metadata, error) {
+	if g.b == nil {
+		return utils.Metadata{}, ErrNotFound
+	}
+	return utils.Metadata{Size: uint64(len(g.b))}, nil
+}
+
+func (g fakeGetter) Has(ctx context.Context, digest utils.Digest) (bool, error) {
+	return g.b != nil, nil
+}
+
+func TestSequenceModes(t *testing.T) {
+	ctx := context.Background()
+	b := []byte("hello")
+	digest := utils.ComputeDigest(b)
+	inner := []Inner{
+		{Name: "missing", ObjectGetter: fakeGetter{}},
+		{Name: "corrupt", ObjectGetter: fakeGetter{b: []byte("corrupt")}},
+		{Name: "slow", ObjectGetter: fakeGetter{b: b, delay: 200 * time.Millisecond}},
+		{Name: "fast", ObjectGetter: fakeGetter{b: b, delay: 10 * time.Millisecond}},
+	}
+	for _, mode := range []FetchMode{FetchSequential, FetchRace, FetchHedged} {
+		stats := NewStats()
+		s := Sequence{
+			Inner:      inner,
+			Mode:       mode,
+			HedgeDelay: time.Millisecond,
+			Stats:      stats,
+		}
+		got, err := s.Get(ctx, digest)
+		if err != nil {
+			t.Fatalf("mode %d: unexpected error: %v", mode, err)
+		}
+		if !bytes.Equal(got, b) {
+			t.Fatalf("mode %d: got %q, want %q", mode, got, b)
+		}
+		if r := stats.Get("corrupt"); r.Errors != 1 {
+			t.Fatalf("mode %d: corrupt response not recorded as error: %+v", mode, r)
+		}
+		if mode != FetchSequential {
+			if r := stats.Get("fast"); r.Successes != 1 {
+				t.Fatalf("mode %d: fast remote did not win: %+v", mode, r)
+			}
+			// The slow remote was cancelled, and is still unmeasured, so it gets tried first; the
+			// remotes that did not return the object are tried last.
+			order := []string{}
+			for _, ss := range stats.order(inner) {
+				order = append(order, ss.Name)
+			}
+			if !reflect.DeepEqual(order, []string{"slow", "fast", "missing", "corrupt"}) {
+				t.Fatalf("mode %d: unexpected order: %v", mode, order)
+			}
+		}
+	}
+}
+
+func TestSequenceHedgeOnFailure(t *testing.T) {
+	ctx := context.Background()
+	b := []byte("hello")
+	s := Sequence{
+		Inner: []Inner{
+			{Name: "missing", ObjectGetter: fakeGetter{}},
+			{Name: "fast", ObjectGetter: fakeGetter{b: b}},
+		},
+		Mode:       FetchHedged,
+		HedgeDelay: time.Hour,
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Get(ctx, utils.ComputeDigest(b))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("next remote not started after the first one failed")
+	}
+}
+
+func TestSequenceSHA512(t *testing.T) {
+	ctx := context.Background()
+	b := []byte("hello")
+	digest, err := multihash.Sum(b, multihash.SHA2_512, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := Sequence{
+		Inner: []Inner{
+			{Name: "remote", ObjectGetter: fakeGetter{b: b}},
+		},
+	}
+	got, err := s.Get(ctx, utils.Digest(digest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, b) {
+		t.Fatalf("got %q, want %q", got, b)
+	}
+}
+
+// failingStore is an ObjectStore that fails all writes.
+type failingStore struct {
+	fakeGetter
+}
+
+func (failingStore) Put(ctx context.Context, b []byte) (utils.Digest, error) {
+	return nil, fmt.Errorf("read only")
+}
+
+func TestSequencePut(t *testing.T) {
+	ctx := context.Background()
+	b := []byte("hello")
+	newStore := func() objectstore.Store {
+		return objectstore.Store{
+			Inner: datastore.InMemory{
+				Inner: map[string][]byte{},
+			},
+		}
+	}
+	existing := newStore()
+	existing.Put(ctx, b)
+	inner := []Inner{
+		{Name: "existing", ObjectGetter: existing, Write: true},
+		{Name: "empty", ObjectGetter: newStore(), Write: true},
+		{Name: "failing", ObjectGetter: failingStore{}, Write: true},
+		{Name: "readonly", ObjectGetter: newStore()},
+	}
+
+	s := Sequence{
+		Inner:       inner,
+		WritePolicy: WriteAll,
+	}
+	_, results, err := s.PutAll(ctx, b)
+	if err == nil {
+		t.Fatalf("expected error with a failing remote")
+	}
+	statuses := []PutStatus{}
+	for _, r := range results {
+		statuses = append(statuses, r.Status)
+	}
+	if !reflect.DeepEqual(statuses, []PutStatus{PutExisted, PutUploaded, PutFailed}) {
+		t.Fatalf("unexpected statuses: %v", statuses)
+	}
+
+	s.WritePolicy = WriteQuorum
+	s.Background = &sync.WaitGroup{}
+	_, _, err = s.PutAll(ctx, b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s.Background.Wait()
+
+	// Writes that outlive PutAll are reported once they complete.
+	s.WritePolicy = WriteFirst
+	mu := sync.Mutex{}
+	background := map[string]PutStatus{}
+	s.OnBackgroundResult = func(digest utils.Digest, r PutResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		background[r.Name] = r.Status
+	}
+	_, results, err = s.PutAll(ctx, b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s.Background.Wait()
+	pending := 0
+	for _, r := range results {
+		if r.Status == PutPending {
+			pending++
+		}
+	}
+	if len(background) != pending {
+		t.Fatalf("got %d background results, want %d", len(background), pending)
+	}
+	for name, status := range background {
+		if status == PutPending {
+			t.Fatalf("remote %q still pending after completion", name)
+		}
+	}
+}
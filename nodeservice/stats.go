@@ -0,0 +1,112 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nodeservice
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// RemoteStats summarizes the outcome of past requests to a single remote.
+type RemoteStats struct {
+	Requests int
+	// Requests that returned a valid object.
+	Successes int
+	// Requests that failed for reasons other than the object not being found.
+	Errors int
+	// Total latency of successful requests.
+	SuccessLatency time.Duration
+}
+
+func (s RemoteStats) MeanLatency() time.Duration {
+	if s.Successes == 0 {
+		return 0
+	}
+	return s.SuccessLatency / time.Duration(s.Successes)
+}
+
+// score estimates the expected cost of a request to the remote; lower is better. Remotes that have
+// not been tried yet score zero, so that they get a chance to be measured.
+func (s RemoteStats) score() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	if s.Successes == 0 {
+		return float64(time.Hour)
+	}
+	errorRate := float64(s.Errors) / float64(s.Requests)
+	return float64(s.MeanLatency()) * (1 + 10*errorRate)
+}
+
+// Stats records per-remote request statistics. It is safe for concurrent use.
+type Stats struct {
+	mu      sync.Mutex
+	remotes map[string]*RemoteStats
+}
+
+func NewStats() *Stats {
+	return &Stats{
+		remotes: map[string]*RemoteStats{},
+	}
+}
+
+// Get returns a snapshot of the stats of the named remote.
+func (s *Stats) Get(name string) RemoteStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.remotes[name]; ok {
+		return *r
+	}
+	return RemoteStats{}
+}
+
+func (s *Stats) record(name string, latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.remotes[name]
+	if !ok {
+		r = &RemoteStats{}
+		s.remotes[name] = r
+	}
+	r.Requests++
+	switch {
+	case err == nil:
+		r.Successes++
+		r.SuccessLatency += latency
+	case err != ErrNotFound:
+		r.Errors++
+	}
+}
+
+// order returns a copy of inner sorted by score, preserving the original order between remotes with
+// equal scores.
+func (s *Stats) order(inner []Inner) []Inner {
+	s.mu.Lock()
+	scores := make(map[string]float64, len(inner))
+	for _, ss := range inner {
+		if r, ok := s.remotes[ss.Name]; ok {
+			scores[ss.Name] = r.score()
+		}
+	}
+	s.mu.Unlock()
+	out := make([]Inner, len(inner))
+	copy(out, inner)
+	sort.SliceStable(out, func(i, j int) bool {
+		return scores[out[i].Name] < scores[out[j].Name]
+	})
+	return out
+}
@@ -18,8 +18,8 @@ type Store struct {
 func (s Store) Get(ctx context.Context, digest utils.Digest) ([]byte, error) {
 	b, err := s.Inner.Get(ctx, digest.String())
 	if err != nil {
-		decodedDigest, err := multihash.Decode(digest)
-		if err == nil && decodedDigest.Code == multihash.SHA2_256 {
+		decodedDigest, decodeErr := multihash.Decode(digest)
+		if decodeErr == nil && decodedDigest.Code == multihash.SHA2_256 {
 			oldDigest := utils.DigestToHumanString(digest)
 			log.Infof(ctx, "decoded digest: %v", decodedDigest)
 			log.Infof(ctx, "old digest: %v", oldDigest)
@@ -48,6 +48,18 @@ func (s Store) Put(ctx context.Context, b []byte) (utils.Digest, error) {
 	return digest, nil
 }
 
+func (s Store) GetMetadata(ctx context.Context, digest utils.Digest) (utils.Metadata, error) {
+	m, err := s.Inner.GetMetadata(ctx, digest.String())
+	if err == datastore.ErrNotFound {
+		decodedDigest, err := multihash.Decode(digest)
+		if err == nil && decodedDigest.Code == multihash.SHA2_256 {
+			return s.Inner.GetMetadata(ctx, utils.DigestToHumanString(digest))
+		}
+		return utils.Metadata{}, datastore.ErrNotFound
+	}
+	return m, err
+}
+
 func (s Store) Has(ctx context.Context, digest utils.Digest) (bool, error) {
 	return s.Inner.Has(ctx, digest.String())
 }
@@ -16,9 +16,11 @@
 package utils
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/google/ent/api"
 	pb "github.com/google/ent/proto"
@@ -31,6 +33,13 @@ type DigestArray [64]byte
 
 const hash = multihash.SHA2_256
 
+// Short names commonly used for digest prefixes (e.g. "sha256:..."), in addition to the canonical
+// multihash names (e.g. "sha2-256:...").
+var digestCodeAliases = map[string]uint64{
+	"sha256": multihash.SHA2_256,
+	"sha512": multihash.SHA2_512,
+}
+
 func ParseDigest(s string) (Digest, error) {
 	digest, err := multihash.FromHexString(s)
 	if err == nil {
@@ -43,6 +52,9 @@ func ParseDigest(s string) (Digest, error) {
 			parts := strings.Split(s, ":")
 			if len(parts) == 2 {
 				code, ok := multihash.Names[strings.ToLower(parts[0])]
+				if !ok {
+					code, ok = digestCodeAliases[strings.ToLower(parts[0])]
+				}
 				if !ok {
 					return nil, fmt.Errorf("invalid digest code: %q", parts[0])
 				}
@@ -98,6 +110,27 @@ func ComputeDigest(b []byte) Digest {
 	return Digest(d)
 }
 
+// MatchesDigest returns whether b hashes to digest, using the hash function that digest specifies.
+func MatchesDigest(b []byte, digest Digest) bool {
+	m, err := multihash.Decode(digest)
+	if err != nil {
+		return false
+	}
+	d, err := multihash.Sum(b, m.Code, m.Length)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(d, digest)
+}
+
+// Metadata describes an object without its contents. Fields that a store does not know about are
+// left as zero values.
+type Metadata struct {
+	Size         uint64
+	MediaType    string
+	CreationTime time.Time
+}
+
 type NodeID struct {
 	Root cid.Cid
 	Path Path
@@ -150,3 +183,53 @@ func DigestToApi(digest Digest) api.HexDigests {
 		panic(fmt.Sprintf("unsupported hash code: %v", mh.Code))
 	}
 }
+
+// ComputeApiDigests computes all the digests of b that can be represented in api.HexDigests.
+func ComputeApiDigests(b []byte) api.HexDigests {
+	sum := func(code uint64) string {
+		d, err := multihash.Sum(b, code, -1)
+		if err != nil {
+			panic(err)
+		}
+		m, err := multihash.Decode(d)
+		if err != nil {
+			panic(err)
+		}
+		return hex.EncodeToString(m.Digest)
+	}
+	return api.HexDigests{
+		Sha2_256: sum(multihash.SHA2_256),
+		Sha2_512: sum(multihash.SHA2_512),
+		Sha3_256: sum(multihash.SHA3_256),
+		Sha3_384: sum(multihash.SHA3_384),
+		Sha3_512: sum(multihash.SHA3_512),
+	}
+}
+
+// DigestFromApi returns the digest from the first non-empty field of d.
+func DigestFromApi(d api.HexDigests) (Digest, error) {
+	for _, v := range []struct {
+		code uint64
+		hex  string
+	}{
+		{multihash.SHA2_256, d.Sha2_256},
+		{multihash.SHA2_512, d.Sha2_512},
+		{multihash.SHA3_256, d.Sha3_256},
+		{multihash.SHA3_384, d.Sha3_384},
+		{multihash.SHA3_512, d.Sha3_512},
+	} {
+		if v.hex == "" {
+			continue
+		}
+		b, err := hex.DecodeString(v.hex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex digest: %w", err)
+		}
+		digest, err := multihash.Encode(b, v.code)
+		if err != nil {
+			return nil, err
+		}
+		return Digest(digest), nil
+	}
+	return nil, fmt.Errorf("no digest specified")
+}
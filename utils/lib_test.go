@@ -18,6 +18,8 @@ package utils
 import (
 	"bytes"
 	"testing"
+
+	"github.com/google/ent/api"
 )
 
 func TestParseDigest(t *testing.T) {
@@ -53,3 +55,37 @@ func TestDigestToArray(t *testing.T) {
 		t.Fatalf("digest array should be equal:\n%x\n%x", digestArray, expectedDigestArray)
 	}
 }
+
+func TestDigestFromApi(t *testing.T) {
+	digest := ComputeDigest([]byte("hello"))
+	got, err := DigestFromApi(DigestToApi(digest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, digest) {
+		t.Fatalf("got %s, want %s", got, digest)
+	}
+	all := ComputeApiDigests([]byte("hello"))
+	if all.Sha2_256 != DigestToApi(digest).Sha2_256 || all.Sha3_512 == "" {
+		t.Fatalf("unexpected digests: %+v", all)
+	}
+	if _, err := DigestFromApi(api.HexDigests{}); err == nil {
+		t.Fatalf("expected error for empty digests")
+	}
+}
+
+func TestMatchesDigest(t *testing.T) {
+	b := []byte("hello")
+	sha512, err := ParseDigest("sha512:9b71d224bd62f3785d96d46ad3ea3d73319bfbc2890caadae2dff72519673ca72323c3d99ba5c11d7c7acc6e14b8c5da0c4663475c2e5c3adef46f73bcdec043")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, digest := range []Digest{ComputeDigest(b), sha512} {
+		if !MatchesDigest(b, digest) {
+			t.Fatalf("MatchesDigest(%q, %s) = false", b, digest)
+		}
+		if MatchesDigest([]byte("world"), digest) {
+			t.Fatalf("MatchesDigest(%q, %s) = true", "world", digest)
+		}
+	}
+}
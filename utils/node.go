@@ -36,6 +36,10 @@ type DAGNode struct {
 const (
 	TypeRaw = cid.Raw
 	TypeDAG = 0x70
+	// Links to encrypted objects, from the private use range of the multicodec table. See package
+	// encryption.
+	TypeEncryptedRaw = 0x300055
+	TypeEncryptedDAG = 0x300070
 )
 
 type Path []Selector
@@ -172,12 +176,16 @@ func ParseDAGNode(b []byte) (*DAGNode, error) {
 		return nil, fmt.Errorf("invalid DAGNode, too short: %d", len(b))
 	}
 	// https://fuchsia.dev/fuchsia-src/reference/fidl/language/wire-format#envelopes
-	log.Printf("ParseDAGNode: %x", b)
 	bytesNum := order.Uint64(b[0:8])
-	log.Printf("bytesNum: %d", bytesNum)
 	linksNum := order.Uint64(b[8:16])
-	log.Printf("linksNum: %d", linksNum)
+	if bytesNum > uint64(len(b)-16) {
+		return nil, fmt.Errorf("invalid DAGNode, bytes overflow: %d", bytesNum)
+	}
 	linkReader := bytes.NewReader(b[16+bytesNum:])
+	// Each link takes at least one byte, which bounds the allocation below.
+	if linksNum > uint64(linkReader.Len()) {
+		return nil, fmt.Errorf("invalid DAGNode, links overflow: %d", linksNum)
+	}
 	links := make([]cid.Cid, linksNum)
 	for i := 0; i < int(linksNum); i++ {
 		link, err := DecodeLink(linkReader)
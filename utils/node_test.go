@@ -18,6 +18,9 @@ package utils
 import (
 	"reflect"
 	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
 )
 
 func TestParseSelector(t *testing.T) {
@@ -91,3 +94,57 @@ func TestParsePath(t *testing.T) {
 		})
 	}
 }
+
+func TestParseDAGNode(t *testing.T) {
+	link := cid.NewCidV1(TypeRaw, multihash.Multihash(ComputeDigest([]byte("hello"))))
+	b, err := SerializeDAGNode(&DAGNode{
+		Bytes: []byte("hello.txt"),
+		Links: []cid.Cid{link},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, err := ParseDAGNode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(node.Bytes) != "hello.txt" || len(node.Links) != 1 || !node.Links[0].Equals(link) {
+		t.Errorf("ParseDAGNode() = %v, want the serialized node", node)
+	}
+
+	header := func(bytesNum, linksNum uint64) []byte {
+		h := make([]byte, 16)
+		order.PutUint64(h[0:8], bytesNum)
+		order.PutUint64(h[8:16], linksNum)
+		return h
+	}
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{
+			name: "too short",
+			b:    []byte{0, 1, 2},
+		},
+		{
+			name: "bytes overflow",
+			b:    header(1<<62, 0),
+		},
+		{
+			// Must be rejected before allocating the links.
+			name: "links overflow",
+			b:    append(header(0, 1<<62), 0),
+		},
+		{
+			name: "truncated link",
+			b:    append(header(0, 1), b[len(b)-3:]...),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseDAGNode(tt.b); err == nil {
+				t.Errorf("ParseDAGNode() succeeded, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base32"
+	"fmt"
+	"strings"
+
+	pb "github.com/google/ent/proto"
+)
+
+// Tags are signed with ECDSA over the SHA-256 digest of a fixed encoding of their fields (see
+// tagDigest), and carry the PKIX DER encoding of the public key that signed them.
+
+// tagSignaturePrefix separates signatures over tags from signatures made with the same key over
+// anything else.
+const tagSignaturePrefix = "ent tag v1\x00"
+
+// PublicKeyID returns a short identifier for the public key, which is a valid DNS label.
+func PublicKeyID(pk *ecdsa.PublicKey) (string, error) {
+	b, err := x509.MarshalPKIXPublicKey(pk)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(b)
+	return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(h[:20])), nil
+}
+
+// tagDigest returns the digest that is signed for the tag. Rather than relying on the serialization
+// of the message, which protobuf does not guarantee to be stable, it is computed over the prefix
+// followed by the label, the code and bytes of the target digest and the sequence number, with
+// variable length fields preceded by their length, and all integers encoded as uvarints.
+func tagDigest(tag *pb.Tag) ([]byte, error) {
+	if tag.GetTarget() == nil {
+		return nil, fmt.Errorf("missing tag target")
+	}
+	b := bytes.Buffer{}
+	b.WriteString(tagSignaturePrefix)
+	WriteUint64(&b, uint64(len(tag.Label)))
+	b.WriteString(tag.Label)
+	WriteUint64(&b, tag.Target.Code)
+	WriteUint64(&b, uint64(len(tag.Target.Digest)))
+	b.Write(tag.Target.Digest)
+	WriteUint64(&b, tag.Sequence)
+	h := sha256.Sum256(b.Bytes())
+	return h[:], nil
+}
+
+func SignTag(tag *pb.Tag, key *ecdsa.PrivateKey) (*pb.SignedTag, error) {
+	h, err := tagDigest(tag)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := ecdsa.SignASN1(rand.Reader, key, h)
+	if err != nil {
+		return nil, fmt.Errorf("could not sign tag: %w", err)
+	}
+	pk, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.SignedTag{
+		Tag:          tag,
+		TagSignature: sig,
+		PublicKey:    pk,
+	}, nil
+}
+
+// VerifyTag checks the signature of the tag against the public key it carries, and returns that
+// key. Callers still need to check that the key is the one they expect.
+func VerifyTag(st *pb.SignedTag) (*ecdsa.PublicKey, error) {
+	if st.GetTag() == nil {
+		return nil, fmt.Errorf("missing tag")
+	}
+	k, err := x509.ParsePKIXPublicKey(st.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	pk, ok := k.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("not an ECDSA public key: %T", k)
+	}
+	h, err := tagDigest(st.Tag)
+	if err != nil {
+		return nil, err
+	}
+	if !ecdsa.VerifyASN1(pk, h, st.TagSignature) {
+		return nil, fmt.Errorf("invalid tag signature")
+	}
+	return pk, nil
+}
@@ -0,0 +1,69 @@
+//
+// Copyright 2023 The Ent Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	pb "github.com/google/ent/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSignTag(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := SignTag(&pb.Tag{
+		Label:    "docs",
+		Target:   DigestToProto(ComputeDigest([]byte("hello"))),
+		Sequence: 1,
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, err := VerifyTag(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pk.Equal(&key.PublicKey) {
+		t.Fatalf("unexpected public key")
+	}
+
+	for _, modify := range []func(tag *pb.Tag){
+		func(tag *pb.Tag) { tag.Label = "other" },
+		func(tag *pb.Tag) { tag.Target = DigestToProto(ComputeDigest([]byte("other"))) },
+		func(tag *pb.Tag) { tag.Target.Code = 0x13 },
+		func(tag *pb.Tag) { tag.Sequence = 2 },
+	} {
+		modified := proto.Clone(st).(*pb.SignedTag)
+		modify(modified.Tag)
+		if _, err := VerifyTag(modified); err == nil {
+			t.Errorf("expected modified tag to be rejected: %v", modified.Tag)
+		}
+	}
+
+	id, err := PublicKeyID(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(id) != 32 {
+		t.Fatalf("unexpected public key ID length: %q", id)
+	}
+}